@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Inspect the YNAB credentials ynabu uses",
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check the YNAB token of the selected profile (or of every profile with --all) against the API",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+		all, _ := cmd.Flags().GetBool("all")
+
+		names := []string{cfg.Profile}
+		if all {
+			names = append([]string{""}, cfg.ProfileNames()...)
+		}
+
+		failed := 0
+		for _, name := range names {
+			if err := authStatus(cfg, name); err != nil {
+				failed++
+				fmt.Printf("  ✗ %v\n", err)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d token(s) failed", failed, len(names))
+		}
+		return nil
+	},
+}
+
+// authStatus prints where the token of a profile comes from and checks it
+// with GET /user. The token itself is never printed.
+func authStatus(cfg *config.Config, profile string) error {
+	label := profile
+	if label == "" {
+		label = "(top-level)"
+	}
+	fmt.Printf("profile %s\n", label)
+
+	pcfg, err := cfg.WithProfile(profile)
+	if err != nil {
+		return err
+	}
+	if pcfg.YNAB.Token == "" {
+		return fmt.Errorf("no token configured (set ynab.token)")
+	}
+	fmt.Printf("  token from %s\n", pcfg.YNAB.TokenSource)
+
+	client := ynab.New(pcfg.YNAB.Token)
+	user, err := client.GetUser()
+	if err != nil {
+		return fmt.Errorf("token rejected: %w", err)
+	}
+	fmt.Printf("  ✓ valid, user %s\n", user.ID)
+	if rl := client.RateLimit(); rl.Known() {
+		fmt.Printf("  rate limit: %d of %d requests left\n", rl.Remaining(), rl.Limit)
+	}
+	return nil
+}
+
+func init() {
+	authStatusCmd.Flags().Bool("all", false, "Check the top-level token and every profile")
+	authCmd.AddCommand(authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+var budgetsCmd = &cobra.Command{
+	Use:   "budgets",
+	Short: "List the YNAB budgets available to the token, to find names and IDs for manifests",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+
+		asJSON, err := jsonOutput(cmd)
+		if err != nil {
+			return err
+		}
+
+		budgets, err := newClient(cfg).GetBudgets()
+		if err != nil {
+			return fmt.Errorf("failed to list budgets: %w", err)
+		}
+		views := ynab.NewBudgetViews(budgets)
+		if asJSON {
+			return writeJSON(views)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tID\tLAST MODIFIED")
+		for _, b := range views {
+			modified := ""
+			if b.LastModifiedOn != nil {
+				modified = b.LastModifiedOn.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", b.Name, b.ID, modified)
+		}
+		return w.Flush()
+	},
+}
+
+var accountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "List the accounts of a budget, to find names and IDs for manifests",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+		budgetRef, _ := cmd.Flags().GetString("budget")
+		showClosed, _ := cmd.Flags().GetBool("closed")
+		budgetRef, _ = executors.BudgetRef(&models.Statement{Budget: budgetRef}, cfg)
+		asJSON, err := jsonOutput(cmd)
+		if err != nil {
+			return err
+		}
+
+		client := newClient(cfg)
+		budgetID, err := ynab.NewResolver(client).Budget(budgetRef)
+		if err != nil {
+			return err
+		}
+		accounts, err := client.GetAccounts(budgetID)
+		if err != nil {
+			return fmt.Errorf("failed to list accounts: %w", err)
+		}
+
+		views := ynab.NewAccountViews(accounts, showClosed)
+		if asJSON {
+			return writeJSON(views)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tID\tTYPE\tBALANCE\tSTATUS")
+		for _, a := range views {
+			status := "open"
+			if a.Closed {
+				status = "closed"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%s\n", a.Name, a.ID, a.Type, a.Balance, status)
+		}
+		return w.Flush()
+	},
+}
+
+// jsonOutput reports whether --output selects JSON. The listings have no
+// markdown form.
+func jsonOutput(cmd *cobra.Command) (bool, error) {
+	output, _ := cmd.Flags().GetString("output")
+	switch output {
+	case "", "table":
+		return false, nil
+	case "json":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown output format %q (expected table or json)", output)
+	}
+}
+
+// writeJSON prints v as indented JSON, like plan -o json does.
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func init() {
+	accountsCmd.Flags().String("budget", "", "Budget name or ID (default: ynab.budget_id from the config, then last-used)")
+	accountsCmd.Flags().Bool("closed", false, "Include closed accounts")
+	for _, c := range []*cobra.Command{budgetsCmd, accountsCmd} {
+		c.Flags().StringP("output", "o", "table", "Output format (table, json)")
+	}
+	rootCmd.AddCommand(budgetsCmd, accountsCmd)
+}
@@ -1,10 +1,6 @@
 package main
 
 import (
-	"strings"
-	"time"
-
-	"github.com/yurifrl/ynabu/pkg/csv"
 	"github.com/yurifrl/ynabu/pkg/models"
 )
 
@@ -16,31 +12,28 @@ type filters struct {
 	payee     string
 }
 
-func (f *filters) toFilterFunc() csv.FilterFunc[*models.Transaction] {
-	return func(t *models.Transaction) bool {
-		if f.startDate != "" {
-			start, _ := time.Parse("2006/01/02", f.startDate)
-			date, _ := time.Parse("2006/01/02", t.Date())
-			if date.Before(start) {
-				return false
-			}
-		}
-		if f.endDate != "" {
-			end, _ := time.Parse("2006/01/02", f.endDate)
-			date, _ := time.Parse("2006/01/02", t.Date())
-			if date.After(end) {
-				return false
-			}
-		}
-		if f.minAmount != 0 && t.Amount() < f.minAmount {
-			return false
-		}
-		if f.maxAmount != 0 && t.Amount() > f.maxAmount {
-			return false
-		}
-		if f.payee != "" && !strings.Contains(strings.ToLower(t.Payee()), strings.ToLower(f.payee)) {
-			return false
-		}
-		return true
+// filter converts the global filter flags into a statement filter. Zero
+// amounts and empty strings mean "not set".
+func (f *filters) filter() models.Filter {
+	out := models.Filter{Start: f.startDate, End: f.endDate}
+	if f.minAmount != 0 {
+		min := f.minAmount
+		out.Min = &min
+	}
+	if f.maxAmount != 0 {
+		max := f.maxAmount
+		out.Max = &max
 	}
-}
\ No newline at end of file
+	if f.payee != "" {
+		out.Payee.Include = []string{f.payee}
+	}
+	return out
+}
+
+// applyTo fills the options a manifest statement leaves unset from the
+// global filter flags.
+func (f *filters) applyTo(statements []models.Statement) {
+	for i := range statements {
+		statements[i].Filter = statements[i].Filter.Merge(f.filter())
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/journal"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the changes made by the last apply (or by --run)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		logger := cmd.Context().Value(loggerKey).(*log.Logger)
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+		runID, _ := cmd.Flags().GetString("run")
+		autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+
+		j, err := journal.Open(cfg.JournalDir())
+		if err != nil {
+			return err
+		}
+
+		var run *journal.Run
+		if runID != "" {
+			run, err = j.Load(runID)
+		} else {
+			run, err = j.LastUndoable()
+		}
+		if err != nil {
+			return err
+		}
+		if run.Kind != journal.KindApply {
+			return fmt.Errorf("run %s is an %s run, only apply runs can be undone", run.ID, run.Kind)
+		}
+		if run.UndoneBy != "" {
+			return fmt.Errorf("run %s was already undone by %s", run.ID, run.UndoneBy)
+		}
+
+		// Each change is reverted with the token of the profile that made it.
+		profiles := newProfileSet(logger, cfg)
+		var steps []*executors.PlanStep
+		for _, name := range recordProfiles(run) {
+			r, err := profiles.forProfile(name)
+			if err != nil {
+				return err
+			}
+			profileSteps, err := r.exec.PlanUndo(run)
+			if err != nil {
+				return fmt.Errorf("failed to plan undo: %w", err)
+			}
+			steps = append(steps, profileSteps...)
+		}
+
+		total := printSteps(steps)
+		fmt.Printf("\nUndo of run %s (%s): %d change(s)\n", run.ID, run.StartedAt.Local().Format("2006-01-02 15:04"), total)
+		if total == 0 {
+			return nil
+		}
+		if !autoApprove && !confirm() {
+			logger.Info("aborted by user")
+			return nil
+		}
+
+		var undoID string
+		err = journaled(cfg, logger, profiles, journal.KindUndo, func(undo *journal.Run) error {
+			undo.Undoes = run.ID
+			undoID = undo.ID
+			if err := executors.ApplyPlan(steps, profiles.executor); err != nil {
+				return fmt.Errorf("undo failed: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		run.UndoneBy = undoID
+		if err := j.Save(run); err != nil {
+			return fmt.Errorf("failed to update journal: %w", err)
+		}
+		logger.Info("undo completed successfully", "run", run.ID)
+		return nil
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past apply and undo runs recorded in the journal",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+
+		j, err := journal.Open(cfg.JournalDir())
+		if err != nil {
+			return err
+		}
+		runs, err := j.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN\tKIND\tSTARTED\tCREATED\tUPDATED\tDELETED\tSTATUS")
+		for _, run := range runs {
+			status := "ok"
+			switch {
+			case run.Error != "":
+				status = "failed: " + run.Error
+			case run.UndoneBy != "":
+				status = "undone by " + run.UndoneBy
+			case run.Undoes != "":
+				status = "undoes " + run.Undoes
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+				run.ID, run.Kind, run.StartedAt.Local().Format("2006-01-02 15:04"),
+				run.Count(string(executors.ActionCreate)), run.Count(string(executors.ActionUpdate)), run.Count(string(executors.ActionDelete)),
+				status)
+		}
+		return w.Flush()
+	},
+}
+
+// recordProfiles returns the profiles whose tokens made the changes of run,
+// in order of first appearance.
+func recordProfiles(run *journal.Run) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, rec := range run.Records {
+		if !seen[rec.Profile] {
+			seen[rec.Profile] = true
+			names = append(names, rec.Profile)
+		}
+	}
+	return names
+}
+
+// journaler is an executor, or a set of them, whose remote changes can be
+// recorded in a journal run.
+type journaler interface {
+	Journal(run *journal.Run)
+}
+
+// journaled runs fn with every remote change recorded in a new journal run,
+// which is saved even when fn fails half-way so partial applies can be
+// undone too.
+func journaled(cfg *config.Config, logger *log.Logger, exec journaler, kind journal.Kind, fn func(run *journal.Run) error) error {
+	j, err := journal.Open(cfg.JournalDir())
+	if err != nil {
+		return err
+	}
+
+	run := j.Begin(kind)
+	exec.Journal(run)
+	defer exec.Journal(nil)
+
+	runErr := fn(run)
+	if err := j.Finish(run, runErr); err != nil {
+		logger.Error("failed to save journal", "run", run.ID, "err", err)
+	} else if len(run.Records) > 0 {
+		logger.Info("recorded run in journal", "run", run.ID, "changes", len(run.Records))
+	}
+	return runErr
+}
+
+func init() {
+	undoCmd.Flags().String("run", "", "Run ID to undo (default: the last apply not yet undone, see: ynabu history)")
+	undoCmd.Flags().Bool("auto-approve", false, "Skip interactive approval")
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -16,6 +19,7 @@ import (
 	"github.com/yurifrl/ynabu/pkg/config"
 	"github.com/yurifrl/ynabu/pkg/csv"
 	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/journal"
 	"github.com/yurifrl/ynabu/pkg/models"
 	"github.com/yurifrl/ynabu/pkg/parser"
 	"github.com/yurifrl/ynabu/pkg/ynab"
@@ -66,7 +70,7 @@ var rootCmd = &cobra.Command{
 		})
 
 		// Log effective configuration at debug level
-		logger.Info("config", "use_custom_id", cfg.UseCustomID, "log_level", cfg.LogLevel, "port", cfg.Port, "budget_id", cfg.YNAB.BudgetID)
+		logger.Info("config", "use_custom_id", cfg.UseCustomID, "log_level", cfg.LogLevel, "port", cfg.Port, "profile", cfg.Profile, "budget_id", cfg.YNAB.BudgetID, "token_source", cfg.YNAB.TokenSource)
 
 		ctx := context.WithValue(cmd.Context(), loggerKey, logger)
 		ctx = context.WithValue(ctx, configKey, cfg)
@@ -82,43 +86,100 @@ var rootCmd = &cobra.Command{
 var convertCmd = &cobra.Command{
 	Use:   "convert [flags]",
 	Short: "Convert bank statements to YNAB CSV format",
-	Args:  cobra.NoArgs,
+	Long: `Convert bank statements to YNAB CSV format.
+
+--file is a statement (file, directory or glob), printed to stdout, or a YAML
+manifest: each of its statements, with its own options, is then written to
+<newest file name>-ynabu.csv in the current directory, named after the cards
+of its filter, or its position, when statements share a file. Existing files
+are only replaced with --force.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		logger := cmd.Context().Value(loggerKey).(*log.Logger)
 		file := cmd.Flag("file").Value.String()
-
-		fileBytes, err := os.ReadFile(file)
-		if err != nil {
-			return fmt.Errorf("failed to read file: %w", err)
+		selection, _ := cmd.Flags().GetString("select")
+		force, _ := cmd.Flags().GetBool("force")
+
+		manifest := &models.Manifest{Statements: []models.Statement{{FilePath: file, Select: selection}}}
+		toStdout := true
+		if strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml") {
+			mf, err := models.FromFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read manifest: %w", err)
+			}
+			manifest, toStdout = mf, false
+		}
+		cliFilters.applyTo(manifest.Statements)
+		if err := newProfileSet(logger, cmd.Context().Value(configKey).(*config.Config)).prepare(manifest.Statements); err != nil {
+			return err
 		}
 
-		parser := parser.New(logger)
-		transactions, err := parser.ProcessBytes(fileBytes, filepath.Base(file))
+		files := make([][]string, len(manifest.Statements))
+		for i := range manifest.Statements {
+			f, err := manifest.Statements[i].Files()
+			if err != nil {
+				return err
+			}
+			files[i] = f
+		}
+		outputs, err := outputNames(manifest.Statements, files)
 		if err != nil {
-			return fmt.Errorf("failed to process file: %w", err)
+			return err
 		}
 
-		sort.Slice(transactions, func(i, j int) bool {
-			return transactions[i].Date() < transactions[j].Date()
-		})
-
-		outputBytes := csv.Create(transactions, cliFilters.toFilterFunc())
-
-		fmt.Println(string(outputBytes))
+		p := parser.New(logger)
+		for i := range manifest.Statements {
+			st := &manifest.Statements[i]
+			logger.Info("converting", "files", files[i])
+
+			transactions, err := executors.LoadTransactions(p, st, files[i])
+			if err != nil {
+				return fmt.Errorf("failed to process file: %w", err)
+			}
+
+			sort.Slice(transactions, func(i, j int) bool {
+				return transactions[i].Date() < transactions[j].Date()
+			})
+
+			outputBytes := csv.Create(transactions, nil)
+
+			if toStdout {
+				fmt.Println(string(outputBytes))
+				continue
+			}
+			if err := writeOutput(outputs[i], outputBytes, force); err != nil {
+				return err
+			}
+			logger.Info("wrote", "file", outputs[i], "transactions", len(transactions))
+		}
 		return nil
 	},
 }
 
 var applyCmd = &cobra.Command{
-    Use:   "apply",
-    Short: "Apply a YAML plan of statements (creates missing transactions)",
-    Args:  cobra.NoArgs,
+    Use:   "apply [planfile]",
+    Short: "Apply a YAML plan of statements or a saved plan file (creates missing transactions)",
+    Args:  cobra.MaximumNArgs(1),
     RunE: func(cmd *cobra.Command, args []string) error {
         logger := cmd.Context().Value(loggerKey).(*log.Logger)
         cfg := cmd.Context().Value(configKey).(*config.Config)
         manifestPath := cmd.Flag("file").Value.String()
         autoApprove, _ := cmd.Flags().GetBool("auto-approve")
         accountID := cmd.Flag("account-id").Value.String()
+        selection, _ := cmd.Flags().GetString("select")
+
+        if len(args) == 1 {
+            if manifestPath != "" {
+                return fmt.Errorf("--file cannot be combined with a saved plan file")
+            }
+            return applySavedPlan(logger, cfg, args[0], autoApprove)
+        }
+        if manifestPath == "" {
+            manifestPath = cfg.Manifest
+        }
+        if manifestPath == "" {
+            return fmt.Errorf("either a saved plan file or --file is required (or set manifest in the config or profile)")
+        }
 
         var manifest *models.Manifest
         if strings.HasSuffix(manifestPath, ".yaml") || strings.HasSuffix(manifestPath, ".yml") {
@@ -134,39 +195,42 @@ var applyCmd = &cobra.Command{
                 return fmt.Errorf("--account-id is required when applying a single statement file")
             }
             manifest = &models.Manifest{
-                Statements: []models.Statement{{FilePath: manifestPath, AccountID: accountID}},
+                Statements: []models.Statement{{FilePath: manifestPath, Select: selection, AccountID: accountID}},
             }
         }
 
-        ynabClient := ynab.New(cfg.YNAB.Token)
-        exec := executors.New(logger, cfg, ynabClient)
+        cliFilters.applyTo(manifest.Statements)
+        manifest.Statements = models.RouteCards(manifest.Statements)
+        profiles := newProfileSet(logger, cfg)
+        if err := profiles.prepare(manifest.Statements); err != nil {
+            return err
+        }
 
         // Always show the plan first
-        for i := range manifest.Statements {
-            st := &manifest.Statements[i]
-            if err := exec.Plan(st); err != nil {
-                return fmt.Errorf("plan failed: %w", err)
-            }
+        reports, err := planStatements(profiles, manifest.Statements)
+        if err != nil {
+            return fmt.Errorf("plan failed: %w", err)
+        }
+        if err := executors.Render(os.Stdout, executors.FormatTable, reports); err != nil {
+            return err
         }
+        steps, err := planSteps(reports)
+        if err != nil {
+            return err
+        }
+        profiles.warnQuota(steps)
 
-        if !autoApprove {
-            fmt.Println("Do you want to perform these actions?")
-            fmt.Println("  Only 'yes' will be accepted to approve.")
-            fmt.Print("Enter a value: ")
-            var input string
-            fmt.Scanln(&input)
-            input = strings.ToLower(strings.TrimSpace(input))
-            if input != "yes" {
-                logger.Info("aborted by user")
-                return nil
-            }
+        if !autoApprove && !confirm() {
+            logger.Info("aborted by user")
+            return nil
         }
 
-        for i := range manifest.Statements {
-            st := &manifest.Statements[i]
-            if err := exec.Apply(st); err != nil {
-                return fmt.Errorf("apply failed: %w", err)
-            }
+        // Apply exactly what was shown, refusing accounts changed since.
+        err = journaled(cfg, logger, profiles, journal.KindApply, func(*journal.Run) error {
+            return applySteps(profiles, steps)
+        })
+        if err != nil {
+            return err
         }
         logger.Info("apply completed successfully")
         return nil
@@ -183,38 +247,44 @@ var applyStatementCmd = &cobra.Command{
 
         filePath := cmd.Flag("file").Value.String()
         accountID := cmd.Flag("account-id").Value.String()
+        selection, _ := cmd.Flags().GetString("select")
         autoApprove, _ := cmd.Flags().GetBool("auto-approve")
 
         manifest := &models.Manifest{
-            Statements: []models.Statement{{FilePath: filePath, AccountID: accountID}},
+            Statements: []models.Statement{{FilePath: filePath, Select: selection, AccountID: accountID}},
         }
 
-        ynabClient := ynab.New(cfg.YNAB.Token)
-        exec := executors.New(logger, cfg, ynabClient)
+        cliFilters.applyTo(manifest.Statements)
+        manifest.Statements = models.RouteCards(manifest.Statements)
+        profiles := newProfileSet(logger, cfg)
+        if err := profiles.prepare(manifest.Statements); err != nil {
+            return err
+        }
 
-        st := &manifest.Statements[0]
-        if err := exec.Plan(st); err != nil {
+        reports, err := planStatements(profiles, manifest.Statements)
+        if err != nil {
             return fmt.Errorf("plan failed: %w", err)
         }
+        if err := executors.Render(os.Stdout, executors.FormatTable, reports); err != nil {
+            return err
+        }
+        steps, err := planSteps(reports)
+        if err != nil {
+            return err
+        }
+        profiles.warnQuota(steps)
 
-        if !autoApprove {
-            fmt.Println("Do you want to perform these actions?")
-            fmt.Println("  Only 'yes' will be accepted to approve.")
-            fmt.Print("Enter a value: ")
-            var input string
-            fmt.Scanln(&input)
-            input = strings.ToLower(strings.TrimSpace(input))
-            if input != "yes" {
-                logger.Info("aborted by user")
-                return nil
-            }
+        if !autoApprove && !confirm() {
+            logger.Info("aborted by user")
+            return nil
         }
 
-        for i := range manifest.Statements {
-            st := &manifest.Statements[i]
-            if err := exec.Apply(st); err != nil {
-                return fmt.Errorf("apply failed: %w", err)
-            }
+        // Apply exactly what was shown, refusing accounts changed since.
+        err = journaled(cfg, logger, profiles, journal.KindApply, func(*journal.Run) error {
+            return applySteps(profiles, steps)
+        })
+        if err != nil {
+            return err
         }
         logger.Info("apply completed successfully")
         return nil
@@ -229,6 +299,12 @@ var planCmd = &cobra.Command{
 		logger := cmd.Context().Value(loggerKey).(*log.Logger)
 		cfg := cmd.Context().Value(configKey).(*config.Config)
 		file := cmd.Flag("file").Value.String()
+		if file == "" {
+			file = cfg.Manifest
+		}
+		if file == "" {
+			return fmt.Errorf("--file is required (or set manifest in the config or profile)")
+		}
 
 		manifest, err := models.FromFile(file)
 		if err != nil {
@@ -237,17 +313,19 @@ var planCmd = &cobra.Command{
 
 		logger.Debug("plan", "planPath", file)
 
-		ynabClient := ynab.New(cfg.YNAB.Token)
+		cliFilters.applyTo(manifest.Statements)
+		manifest.Statements = models.RouteCards(manifest.Statements)
+		profiles := newProfileSet(logger, cfg)
+		if err := profiles.prepare(manifest.Statements); err != nil {
+			return err
+		}
 
-		exec := executors.New(logger, cfg, ynabClient)
-        for i := range manifest.Statements {
-            st := &manifest.Statements[i]
-            if err := exec.Plan(st); err != nil {
-                return fmt.Errorf("failed to plan: %w", err)
-            }
-        }
+		reports, err := planStatements(profiles, manifest.Statements)
+		if err != nil {
+			return fmt.Errorf("failed to plan: %w", err)
+		}
 
-		return nil
+		return outputPlan(cmd, profiles, reports)
 	},
 }
 
@@ -261,33 +339,218 @@ var planStatementsCmd = &cobra.Command{
 
         file := cmd.Flag("file").Value.String()
         accountID := cmd.Flag("account-id").Value.String()
+        selection, _ := cmd.Flags().GetString("select")
 
         manifest := &models.Manifest{
             Statements: []models.Statement{
                 {
-                    FilePath: file,
+                    FilePath:  file,
+                    Select:    selection,
                     AccountID: accountID,
                 },
             },
         }
 
-        ynabClient := ynab.New(cfg.YNAB.Token)
-        exec := executors.New(logger, cfg, ynabClient)
+        cliFilters.applyTo(manifest.Statements)
+        manifest.Statements = models.RouteCards(manifest.Statements)
+        profiles := newProfileSet(logger, cfg)
+        if err := profiles.prepare(manifest.Statements); err != nil {
+            return err
+        }
 
-        st := &manifest.Statements[0]
-        if err := exec.Plan(st); err != nil {
+        reports, err := planStatements(profiles, manifest.Statements)
+        if err != nil {
             return fmt.Errorf("failed to plan: %w", err)
         }
 
-        return nil
+        return outputPlan(cmd, profiles, reports)
     },
 }
 
+// outputPlan prints the reports in the format selected with --output and
+// saves them to the file given with --out, if any.
+func outputPlan(cmd *cobra.Command, profiles *profileSet, reports []*executors.Report) error {
+	output, _ := cmd.Flags().GetString("output")
+	format, err := executors.ParseFormat(output)
+	if err != nil {
+		return err
+	}
+	if err := executors.Render(os.Stdout, format, reports); err != nil {
+		return err
+	}
+
+	steps, err := planSteps(reports)
+	if err != nil {
+		return err
+	}
+	profiles.warnQuota(steps)
+
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		return nil
+	}
+	if err := executors.WritePlanFile(out, steps); err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+
+	// Keep stdout parseable for the machine-readable formats.
+	w := os.Stdout
+	if format != executors.FormatTable {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "\nSaved the plan to: %s\n\n", out)
+	fmt.Fprintf(w, "To perform exactly these actions, run:\n  ynabu apply %s\n", out)
+	return nil
+}
+
+// newClient builds the YNAB client used by the commands, backed by the local
+// transaction cache unless it is disabled.
+func newClient(cfg *config.Config) ynab.Client {
+	client := ynab.New(cfg.YNAB.Token)
+	if cfg.NoCache {
+		return client
+	}
+	return ynab.NewCachedClient(client, ynab.CacheDir(cfg.CacheDir(), cfg.YNAB.Token))
+}
+
+// planStatements plans every statement with the executor of its profile.
+func planStatements(profiles *profileSet, statements []models.Statement) ([]*executors.Report, error) {
+	reports := make([]*executors.Report, 0, len(statements))
+	for i := range statements {
+		st := &statements[i]
+		r, err := profiles.forStatement(st)
+		if err != nil {
+			return nil, err
+		}
+		report, err := r.exec.Plan(st)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// planSteps turns reports into the steps applying them would execute.
+func planSteps(reports []*executors.Report) ([]*executors.PlanStep, error) {
+	steps := make([]*executors.PlanStep, 0, len(reports))
+	for _, r := range reports {
+		step, err := r.Step()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build plan step for %s: %w", r.File, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// warnQuota warns when the YNAB quota left is smaller than the number of
+// requests applying steps would take, so a large run is not cut short by a
+// 429 halfway through.
+func warnQuota(logger *log.Logger, client ynab.Client, batchSize int, steps []*executors.PlanStep) {
+	rl := client.RateLimit()
+	if !rl.Known() {
+		return
+	}
+	needed := 0
+	for _, step := range steps {
+		needed += step.Requests(batchSize)
+	}
+	if rl.Remaining() < needed {
+		logger.Warn("YNAB rate limit too low to apply this plan in one go", "remaining", rl.Remaining(), "limit", rl.Limit, "needed", needed)
+	}
+}
+
+// applySavedPlan executes a plan file written by `ynabu plan --out`.
+func applySavedPlan(logger *log.Logger, cfg *config.Config, path string, autoApprove bool) error {
+	pf, err := executors.ReadPlanFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	total := printSteps(pf.Steps)
+	fmt.Printf("\nSaved plan from %s: %d change(s)\n", pf.CreatedAt.Local().Format("2006-01-02 15:04"), total)
+
+	if total == 0 {
+		return nil
+	}
+	if !autoApprove && !confirm() {
+		logger.Info("aborted by user")
+		return nil
+	}
+
+	profiles := newProfileSet(logger, cfg)
+	err = journaled(cfg, logger, profiles, journal.KindApply, func(*journal.Run) error {
+		return applySteps(profiles, pf.Steps)
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("apply completed successfully")
+	return nil
+}
+
+// applySteps executes steps with the executor of their profile, checking
+// them all first so that steps sharing an account, even across profiles, do
+// not find it stale because of each other. Statements YNAB partly rejected
+// in a --partial apply do not stop the others.
+func applySteps(profiles *profileSet, steps []*executors.PlanStep) error {
+	err := executors.ApplyPlan(steps, profiles.executor)
+	if err != nil && !partialFailure(err) {
+		return fmt.Errorf("apply failed: %w", err)
+	}
+	return err
+}
+
+// printSteps lists the changes of saved or undo plans and returns how many
+// there are in total.
+func printSteps(steps []*executors.PlanStep) int {
+	total := 0
+	for _, step := range steps {
+		fmt.Printf("%s (account %s): %d to create, %d to update, %d to delete\n",
+			step.File, step.AccountID,
+			step.Count(executors.ActionCreate), step.Count(executors.ActionUpdate), step.Count(executors.ActionDelete))
+		for _, c := range step.Changes {
+			if c.Payload == nil {
+				fmt.Printf("  %s %s\n", c.Action, c.TransactionID)
+				continue
+			}
+			payee := ""
+			if c.Payload.PayeeName != nil {
+				payee = *c.Payload.PayeeName
+			}
+			fmt.Printf("  %s %s | %-30s | R$ %.2f\n", c.Action, c.Payload.Date.Format("2006/01/02"), payee, float64(c.Payload.Amount)/1000.0)
+		}
+		total += len(step.Changes)
+	}
+	return total
+}
+
+// partialFailure reports whether err only means YNAB rejected some
+// transactions of a --partial apply, in which case the remaining statements
+// are still applied.
+func partialFailure(err error) bool {
+	var rejected *executors.CreateError
+	return errors.As(err, &rejected)
+}
+
+// confirm asks for interactive approval, Terraform style.
+func confirm() bool {
+	fmt.Println("Do you want to perform these actions?")
+	fmt.Println("  Only 'yes' will be accepted to approve.")
+	fmt.Print("Enter a value: ")
+	var input string
+	fmt.Scanln(&input)
+	return strings.ToLower(strings.TrimSpace(input)) == "yes"
+}
+
 func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "Config file (default is config.yaml)")
 	rootCmd.PersistentFlags().StringP("log-level", "l", "", "Log level (debug, info, warn, error)")
-    rootCmd.PersistentFlags().Bool("use-custom-id", true, "Match transactions by custom ID (default true; set to false to match by amount/date/payee)")
+	rootCmd.PersistentFlags().Bool("use-custom-id", true, "Match transactions by custom ID (default true; set to false to match by amount/date/payee)")
+	rootCmd.PersistentFlags().String("profile", "", "Configuration profile to use (default $YNABU_PROFILE)")
+	rootCmd.PersistentFlags().Bool("no-cache", false, "Always read transactions from YNAB instead of the local cache")
 
 	// Filter flags (global)
 	rootCmd.PersistentFlags().StringVar(&cliFilters.startDate, "start", "", "Start date (YYYY/MM/DD)")
@@ -295,28 +558,88 @@ func init() {
 	rootCmd.PersistentFlags().Float64Var(&cliFilters.minAmount, "min", 0, "Minimum amount")
 	rootCmd.PersistentFlags().Float64Var(&cliFilters.maxAmount, "max", 0, "Maximum amount")
 	rootCmd.PersistentFlags().StringVar(&cliFilters.payee, "payee", "", "Filter by payee (case insensitive)")
-	rootCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "Input path (supports glob patterns)")
+	rootCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "Input path: a file, a directory or a glob pattern")
+	rootCmd.PersistentFlags().String("select", models.SelectAll, "Which files to use when --file matches several: all (overlapping days deduplicated) or newest")
 
 	rootCmd.AddCommand(convertCmd)
 	rootCmd.AddCommand(planCmd)
 	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(historyCmd)
 
-    planCmd.AddCommand(planStatementsCmd)
-    applyCmd.AddCommand(applyStatementCmd)
-    planStatementsCmd.Flags().StringP("account-id", "i", "", "YNAB account ID")
-    planStatementsCmd.MarkFlagRequired("file")
-    planStatementsCmd.MarkFlagRequired("account-id")
+	planCmd.AddCommand(planStatementsCmd)
+	applyCmd.AddCommand(applyStatementCmd)
+	planStatementsCmd.Flags().StringP("account-id", "i", "", "YNAB account ID")
+	planStatementsCmd.MarkFlagRequired("file")
+	planStatementsCmd.MarkFlagRequired("account-id")
 
 	convertCmd.MarkFlagRequired("file")
+	convertCmd.Flags().Bool("force", false, "Replace CSV files that already exist")
 	applyCmd.Flags().Bool("auto-approve", false, "Skip interactive approval and create transactions")
 	applyCmd.Flags().StringP("account-id", "i", "", "YNAB account ID (needed when applying a single statement CSV)")
 	applyStatementCmd.Flags().Bool("auto-approve", false, "Skip interactive approval and create transactions")
-    applyStatementCmd.Flags().StringP("account-id", "i", "", "YNAB account ID")
-    applyStatementCmd.MarkFlagRequired("file")
-    applyStatementCmd.MarkFlagRequired("account-id")
+	applyStatementCmd.Flags().StringP("account-id", "i", "", "YNAB account ID")
+	applyCmd.PersistentFlags().Int("batch-size", 0, "Create at most this many transactions per request (default 100)")
+	applyCmd.PersistentFlags().Bool("partial", false, "When YNAB rejects a batch, still create its valid transactions and report the rejected ones")
+	applyStatementCmd.MarkFlagRequired("file")
+	applyStatementCmd.MarkFlagRequired("account-id")
+
+	planCmd.PersistentFlags().StringP("output", "o", "table", "Output format (table, json, markdown)")
+	planCmd.PersistentFlags().String("out", "", "Save the computed plan to this file so it can be applied exactly with: ynabu apply <file>")
+}
+
+// outputNames returns the CSV file each converted statement is written to:
+// <newest file name>-ynabu.csv, with the cards of its filter, or else its
+// position in the manifest, added when several statements share a file, as
+// when a fatura is split by card. files are the statements' files, newest
+// first. Names still clashing are refused before anything is written.
+func outputNames(statements []models.Statement, files [][]string) ([]string, error) {
+	bases := make([]string, len(statements))
+	count := make(map[string]int)
+	for i, f := range files {
+		base := filepath.Base(f[0])
+		bases[i] = strings.TrimSuffix(base, filepath.Ext(base))
+		count[bases[i]]++
+	}
 
-    applyCmd.MarkFlagRequired("file")
-    planCmd.MarkFlagRequired("file")
+	names := make([]string, len(statements))
+	seen := make(map[string]int)
+	for i, base := range bases {
+		if count[base] > 1 {
+			suffix := strconv.Itoa(i + 1)
+			if cards := statements[i].Filter.Cards; len(cards) > 0 {
+				suffix = strings.Join(cards, "+")
+			}
+			base += "-" + suffix
+		}
+		names[i] = base + "-ynabu.csv"
+		if j, ok := seen[names[i]]; ok {
+			return nil, fmt.Errorf("statements %d and %d would both be written to %s", j+1, i+1, names[i])
+		}
+		seen[names[i]] = i
+	}
+	return names, nil
+}
+
+// writeOutput writes a converted CSV, refusing to replace an existing file
+// unless force is set.
+func writeOutput(path string, data []byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to replace it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
 }
 
 func main() {
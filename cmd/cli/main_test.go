@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+)
+
+func TestOutputNames(t *testing.T) {
+	statements := []models.Statement{
+		{FilePath: "fatura.xls", Filter: models.Filter{Cards: []string{"1234"}}},
+		{FilePath: "fatura.xls", Filter: models.Filter{Cards: []string{"5678", "9012"}}},
+		{FilePath: "fatura.xls"},
+		{FilePath: "extrato.txt"},
+	}
+	files := [][]string{{"in/fatura.xls"}, {"in/fatura.xls"}, {"in/fatura.xls"}, {"in/extrato.txt"}}
+
+	names, err := outputNames(statements, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fatura-1234-ynabu.csv", "fatura-5678+9012-ynabu.csv", "fatura-3-ynabu.csv", "extrato-ynabu.csv"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+
+	// Two statements of the same cards cannot be told apart.
+	statements[1].Filter.Cards = []string{"1234"}
+	if _, err := outputNames(statements, files); err == nil {
+		t.Fatal("expected an error for clashing outputs")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+
+	"github.com/yurifrl/ynabu/pkg/ynab/fake"
+)
+
+var mockYNABCmd = &cobra.Command{
+	Use:   "mock-ynab",
+	Short: "Serve a fake YNAB API backed by a JSON fixture, for offline development",
+	Long: `Serve the subset of the YNAB v1 REST API used by ynabu from memory.
+
+The state is seeded from --fixture and lives only as long as the process.
+Point ynabu (CLI or server) at it with:
+
+  YNAB_BASE_URL=http://localhost:8081/v1 ynabu plan -f manifest.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		logger := cmd.Context().Value(loggerKey).(*log.Logger)
+		fixture, _ := cmd.Flags().GetString("fixture")
+		addr, _ := cmd.Flags().GetString("addr")
+		token, _ := cmd.Flags().GetString("token")
+		rateLimit, _ := cmd.Flags().GetInt("rate-limit")
+
+		client, err := fake.Load(fixture)
+		if err != nil {
+			return fmt.Errorf("failed to load fixture: %w", err)
+		}
+		if rateLimit > 0 {
+			client.SetRateLimit(0, rateLimit)
+		}
+
+		handler := fake.NewHandler(client, token)
+		logger.Info("serving mock YNAB API", "addr", addr, "base_url", fmt.Sprintf("http://%s/v1", addr), "fixture", fixture)
+		return http.ListenAndServe(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("mock request", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery)
+			handler.ServeHTTP(w, r)
+		}))
+	},
+}
+
+func init() {
+	mockYNABCmd.Flags().String("fixture", "hack/mock-ynab.json", "JSON fixture with budgets, accounts and transactions")
+	mockYNABCmd.Flags().String("addr", "localhost:8081", "Address to listen on")
+	mockYNABCmd.Flags().String("token", "", "Only accept this bearer token (default: accept any)")
+	mockYNABCmd.Flags().Int("rate-limit", 0, "Answer 429 after this many requests (default: unlimited)")
+	rootCmd.AddCommand(mockYNABCmd)
+}
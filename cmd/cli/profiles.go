@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/journal"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// profileSet hands out one client and executor per configuration profile, so
+// a single run can sync statements belonging to different YNAB users.
+type profileSet struct {
+	logger *log.Logger
+	cfg    *config.Config // the selected profile
+	byName map[string]*profileRun
+	run    *journal.Run
+}
+
+// profileRun is what a profile needs to talk to YNAB.
+type profileRun struct {
+	cfg      *config.Config
+	client   ynab.Client
+	exec     *executors.Executor
+	resolver *ynab.Resolver
+}
+
+func newProfileSet(logger *log.Logger, cfg *config.Config) *profileSet {
+	return &profileSet{logger: logger, cfg: cfg, byName: make(map[string]*profileRun)}
+}
+
+// forStatement returns the profile a statement is synced with: its own, or
+// the selected one.
+func (p *profileSet) forStatement(st *models.Statement) (*profileRun, error) {
+	if st.Profile == "" {
+		return p.get(p.cfg), nil
+	}
+	return p.forProfile(st.Profile)
+}
+
+// forProfile returns the named profile, the empty name meaning the top-level
+// settings, as recorded on plan steps and journal records. A profile is
+// only applied once, since applying it resolves its token.
+func (p *profileSet) forProfile(name string) (*profileRun, error) {
+	if r, ok := p.byName[name]; ok {
+		return r, nil
+	}
+	cfg, err := p.cfg.WithProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.get(cfg), nil
+}
+
+// executor returns the executor of the profile a plan step was computed
+// with, for executors.ApplyPlan.
+func (p *profileSet) executor(step *executors.PlanStep) (*executors.Executor, error) {
+	r, err := p.forProfile(step.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return r.exec, nil
+}
+
+func (p *profileSet) get(cfg *config.Config) *profileRun {
+	if r, ok := p.byName[cfg.Profile]; ok {
+		return r
+	}
+	client := newClient(cfg)
+	r := &profileRun{
+		cfg:      cfg,
+		client:   client,
+		exec:     executors.New(p.logger, cfg, client),
+		resolver: ynab.NewResolver(client),
+	}
+	r.exec.Journal(p.run)
+	p.byName[cfg.Profile] = r
+	return r
+}
+
+// prepare checks the profiles statements name and fills in what they leave
+// to their profile: the rules file.
+func (p *profileSet) prepare(statements []models.Statement) error {
+	for i := range statements {
+		st := &statements[i]
+		r, err := p.forStatement(st)
+		if err != nil {
+			return err
+		}
+		if st.Rules == "" {
+			st.Rules = r.cfg.Rules
+		}
+	}
+	return nil
+}
+
+// Journal records the changes of every profile's executor into run, see
+// Executor.Journal.
+func (p *profileSet) Journal(run *journal.Run) {
+	p.run = run
+	for _, r := range p.byName {
+		r.exec.Journal(run)
+	}
+}
+
+// warnQuota runs the rate limit check of warnQuota for each profile, as every
+// token has its own quota.
+func (p *profileSet) warnQuota(steps []*executors.PlanStep) {
+	byProfile := make(map[string][]*executors.PlanStep)
+	for _, step := range steps {
+		byProfile[step.Profile] = append(byProfile[step.Profile], step)
+	}
+	names := make([]string, 0, len(byProfile))
+	for name := range byProfile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r, err := p.forProfile(name)
+		if err != nil {
+			continue
+		}
+		warnQuota(p.logger, r.client, p.cfg.BatchSize, byProfile[name])
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/parser"
+	"github.com/yurifrl/ynabu/pkg/rules"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check a manifest: keys, values, files, parsers and rules (and, with --remote, budgets and accounts)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg := cmd.Context().Value(configKey).(*config.Config)
+		file := cmd.Flag("file").Value.String()
+		remote, _ := cmd.Flags().GetBool("remote")
+		if file == "" {
+			return fmt.Errorf("--file is required")
+		}
+
+		manifest, err := models.FromFile(file)
+		if err != nil {
+			return err
+		}
+
+		var profiles *profileSet
+		if remote {
+			profiles = newProfileSet(cmd.Context().Value(loggerKey).(*log.Logger), cfg)
+		}
+
+		failed := 0
+		for i := range manifest.Statements {
+			st := &manifest.Statements[i]
+			files, err := checkStatement(st, cfg, profiles)
+			if err != nil {
+				failed++
+				fmt.Printf("✗ statement %d (%s):\n  %v\n", i+1, st.FilePath, err)
+				continue
+			}
+			fmt.Printf("✓ statement %d (%s): %d file(s)\n", i+1, st.FilePath, len(files))
+			for _, f := range files {
+				fmt.Printf("    %s\n", f)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d statement(s) are invalid", failed, len(manifest.Statements))
+		}
+		return nil
+	},
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of manifests, for editor completion and CI checks",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		_, err := os.Stdout.Write(models.Schema)
+		return err
+	},
+}
+
+// checkStatement runs the checks that need the disk or the config, and YNAB
+// when profiles is set, returning the files the statement matched.
+func checkStatement(st *models.Statement, cfg *config.Config, profiles *profileSet) ([]string, error) {
+	files, err := st.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	if st.Profile != "" {
+		profileCfg, err := cfg.WithProfile(st.Profile)
+		if err != nil {
+			return files, err
+		}
+		cfg = profileCfg
+	}
+	if st.Format != "" {
+		if !slices.Contains(parser.Formats(), st.Format) {
+			errs = append(errs, fmt.Errorf("unknown format %q", st.Format))
+		}
+	} else {
+		for _, f := range files {
+			if parser.DetectFormat(filepath.Base(f)) == "" {
+				errs = append(errs, fmt.Errorf("%s: no parser recognises this file; set format", f))
+			}
+		}
+	}
+	if rulesFile := cmp.Or(st.Rules, cfg.Rules); rulesFile != "" {
+		if _, err := rules.Load(rulesFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if profiles != nil {
+		resolver := profiles.get(cfg).resolver
+		budgetRef, _ := executors.BudgetRef(st, cfg)
+		budgetID, err := resolver.Budget(budgetRef)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			accounts := []string{st.AccountRef()}
+			for _, account := range st.CardAccounts {
+				accounts = append(accounts, account)
+			}
+			for _, account := range accounts {
+				if account == "" {
+					continue
+				}
+				if _, err := resolver.Account(budgetID, account); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return files, errors.Join(errs...)
+}
+
+func init() {
+	validateCmd.Flags().Bool("remote", false, "Also check that budgets and accounts exist in YNAB")
+	rootCmd.AddCommand(validateCmd, schemaCmd)
+}
@@ -4,6 +4,7 @@ go 1.24.5
 
 require (
     github.com/brunomvsouza/ynab.go v1.5.0
+    github.com/charmbracelet/lipgloss v1.0.0
     github.com/charmbracelet/log v0.4.1
     github.com/extrame/xls v0.0.1
     github.com/k0kubun/pp/v3 v3.4.1
@@ -11,16 +12,19 @@ require (
     github.com/spf13/pflag v1.0.5
     github.com/spf13/viper v1.17.0
     github.com/subosito/gotenv v1.6.0
+    github.com/zalando/go-keyring v0.2.8
+    golang.org/x/oauth2 v0.30.0
     gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
     github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
-    github.com/charmbracelet/lipgloss v1.0.0 // indirect
     github.com/charmbracelet/x/ansi v0.4.2 // indirect
+    github.com/danieljoos/wincred v1.2.3 // indirect
     github.com/extrame/ole2 v0.0.0-20160812065207-d69429661ad7 // indirect
     github.com/fsnotify/fsnotify v1.6.0 // indirect
     github.com/go-logfmt/logfmt v0.6.0 // indirect
+    github.com/godbus/dbus/v5 v5.2.2 // indirect
     github.com/hashicorp/hcl v1.0.0 // indirect
     github.com/inconshreveable/mousetrap v1.1.0 // indirect
     github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -9,7 +13,52 @@ import (
 
 type YNABConfig struct {
 	BudgetID string `mapstructure:"budget_id"`
+	// Token is read from the source the setting names, see ResolveSecret;
+	// TokenSource records which kind it was. The token is never logged.
+	Token       string `mapstructure:"token"`
+	TokenSource string `mapstructure:"-"`
+}
+
+// String keeps the token out of logs and error messages that print the
+// configuration.
+func (y YNABConfig) String() string {
+	return fmt.Sprintf("{BudgetID:%s Token:<redacted, from %s>}", y.BudgetID, y.TokenSource)
+}
+
+// DefaultOAuthURL is where YNAB's OAuth endpoints live.
+const DefaultOAuthURL = "https://app.ynab.com"
+
+// OAuthConfig holds the YNAB OAuth application the server signs users in
+// with, using the authorization code flow. Register the application at
+// https://app.ynab.com/settings/developer with RedirectURL as its redirect
+// URI.
+type OAuthConfig struct {
+	ClientID string `mapstructure:"client_id"`
+	// ClientSecret accepts the same sources as the YNAB token.
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL is the server's /auth/callback as reached by browsers,
+	// e.g. https://ynabu.example.com/auth/callback.
+	RedirectURL string `mapstructure:"redirect_url"`
+	// BaseURL hosts /oauth/authorize and /oauth/token, DefaultOAuthURL
+	// unless pointed at a stand-in such as `ynabu mock-ynab`.
+	BaseURL string `mapstructure:"base_url"`
+}
+
+// Enabled reports whether OAuth sign-in is configured.
+func (o OAuthConfig) Enabled() bool {
+	return o.ClientID != ""
+}
+
+// Profile is a named set of YNAB credentials and defaults, for households
+// with several YNAB users or budgets. Empty fields keep the top-level value.
+type Profile struct {
+	// Token accepts the same sources as YNABConfig.Token.
 	Token    string `mapstructure:"token"`
+	BudgetID string `mapstructure:"budget_id"`
+	// Rules is the rules file of statements that set none.
+	Rules string `mapstructure:"rules"`
+	// Manifest is the manifest plan and apply read when --file is not given.
+	Manifest string `mapstructure:"manifest"`
 }
 
 type Config struct {
@@ -17,6 +66,102 @@ type Config struct {
 	LogLevel    string     `mapstructure:"log_level"`
 	UseCustomID bool       `mapstructure:"use_custom_id"`
 	YNAB        YNABConfig `mapstructure:"ynab"`
+	// StateDir holds local state such as the apply journal.
+	StateDir string `mapstructure:"state_dir"`
+	// NoCache disables the CLI's local transaction cache; the server never
+	// uses one.
+	NoCache bool `mapstructure:"no_cache"`
+	// BatchSize caps how many transactions are created per request.
+	BatchSize int `mapstructure:"batch_size"`
+	// Partial lets apply create the valid transactions of a batch YNAB
+	// rejected, reporting the invalid ones instead of stopping.
+	Partial bool `mapstructure:"partial"`
+	// Rules and Manifest are the defaults of Profile.Rules and
+	// Profile.Manifest when no profile overrides them.
+	Rules    string `mapstructure:"rules"`
+	Manifest string `mapstructure:"manifest"`
+	// Profile is the name of the selected profile (--profile or
+	// YNABU_PROFILE), empty when the top-level settings are used.
+	Profile  string             `mapstructure:"profile"`
+	Profiles map[string]Profile `mapstructure:"profiles"`
+	// SessionKey encrypts the server's session cookies; it accepts the
+	// same sources as the YNAB token. When empty a random key is used and
+	// sessions end when the server restarts.
+	SessionKey string `mapstructure:"session_key"`
+	// OAuth enables signing in to the server with a YNAB account.
+	OAuth OAuthConfig `mapstructure:"oauth"`
+
+	// base holds the top-level settings once a profile is applied.
+	base *Config
+}
+
+// WithProfile returns a copy of the top-level settings with the named
+// profile applied. The empty name returns the top-level settings.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	if name == c.Profile {
+		return c, nil
+	}
+	root := c
+	if c.base != nil {
+		root = c.base
+	}
+	if name == "" {
+		return root, nil
+	}
+	p, ok := root.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (known: %s)", name, strings.Join(root.ProfileNames(), ", "))
+	}
+
+	out := *root
+	out.base = root
+	out.Profile = name
+	if p.Token != "" {
+		if err := out.YNAB.resolveToken(p.Token); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	if p.BudgetID != "" {
+		out.YNAB.BudgetID = p.BudgetID
+	}
+	if p.Rules != "" {
+		out.Rules = p.Rules
+	}
+	if p.Manifest != "" {
+		out.Manifest = p.Manifest
+	}
+	return &out, nil
+}
+
+// resolveToken reads the token from the source ref names.
+func (y *YNABConfig) resolveToken(ref string) error {
+	token, err := ResolveSecret(ref)
+	if err != nil {
+		return fmt.Errorf("ynab.token: %w", err)
+	}
+	y.Token = token
+	y.TokenSource, _ = SecretSource(ref)
+	return nil
+}
+
+// ProfileNames returns the configured profile names, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JournalDir is where apply runs are recorded for `ynabu undo`.
+func (c *Config) JournalDir() string {
+	return filepath.Join(c.StateDir, "journal")
+}
+
+// CacheDir is where transactions read from YNAB are cached between runs.
+func (c *Config) CacheDir() string {
+	return filepath.Join(c.StateDir, "cache")
 }
 
 // Load initialises a Viper instance, reads the config file (if any) and returns it.
@@ -33,6 +178,12 @@ func Load(cfgFile string) (*viper.Viper, error) {
 
 	// Environment variables take precedence over config file values.
 	v.AutomaticEnv()
+	// Secrets are often only provided through the environment (e.g. a
+	// Kubernetes secret), so bind them even when the file does not set them.
+	_ = v.BindEnv("session_key", "SESSION_KEY")
+	_ = v.BindEnv("oauth.client_id", "OAUTH_CLIENT_ID")
+	_ = v.BindEnv("oauth.client_secret", "OAUTH_CLIENT_SECRET")
+	_ = v.BindEnv("oauth.redirect_url", "OAUTH_REDIRECT_URL")
 
 	// Ignore not-found error; caller can decide if it's fatal.
 	_ = v.ReadInConfig()
@@ -66,7 +217,68 @@ func Build(cfgFile string, fs *pflag.FlagSet) (*Config, error) {
 	}
 
 	c.UseCustomID = v.GetBool("use-custom-id")
-	c.YNAB.Token = os.ExpandEnv(c.YNAB.Token)
+	if v.GetBool("no-cache") {
+		c.NoCache = true
+	}
+	if n := v.GetInt("batch-size"); n > 0 {
+		c.BatchSize = n
+	}
+	if v.GetBool("partial") {
+		c.Partial = true
+	}
+	if err := c.YNAB.resolveToken(c.YNAB.Token); err != nil {
+		return nil, err
+	}
+	if c.SessionKey, err = ResolveSecret(c.SessionKey); err != nil {
+		return nil, fmt.Errorf("session_key: %w", err)
+	}
+	if c.OAuth.ClientSecret, err = ResolveSecret(c.OAuth.ClientSecret); err != nil {
+		return nil, fmt.Errorf("oauth.client_secret: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.OAuth.BaseURL == "" {
+		c.OAuth.BaseURL = DefaultOAuthURL
+	}
+
+	if c.StateDir == "" {
+		c.StateDir = "~/.ynabu"
+	}
+	if strings.HasPrefix(c.StateDir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		c.StateDir = filepath.Join(home, c.StateDir[2:])
+	}
 
-	return &c, nil
+	// The profile flag wins over YNABU_PROFILE, which wins over a
+	// profile key in the config file.
+	profile := c.Profile
+	if env := os.Getenv("YNABU_PROFILE"); env != "" {
+		profile = env
+	}
+	if fs != nil && fs.Changed("profile") {
+		profile, _ = fs.GetString("profile")
+	}
+	c.Profile = ""
+	return c.WithProfile(profile)
+}
+
+// Validate reports settings that cannot work together, such as OAuth
+// sign-in without a redirect URL.
+func (c *Config) Validate() error {
+	if c.BatchSize < 0 {
+		return fmt.Errorf("batch_size must not be negative, got %d", c.BatchSize)
+	}
+	if c.OAuth.Enabled() {
+		if c.OAuth.RedirectURL == "" {
+			return fmt.Errorf("oauth.redirect_url is required with oauth.client_id")
+		}
+		if c.OAuth.ClientSecret == "" {
+			return fmt.Errorf("oauth.client_secret is required with oauth.client_id")
+		}
+	}
+	return nil
 }
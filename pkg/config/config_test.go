@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const profilesYAML = `
+ynab:
+  budget_id: shared
+  token: top-token
+rules: rules.yaml
+profiles:
+  ana:
+    token: $ANA_TOKEN
+    budget_id: ana-budget
+  bruno:
+    manifest: bruno.yaml
+`
+
+func buildConfig(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(profilesYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("profile", "", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return Build(path, fs)
+}
+
+func TestProfiles(t *testing.T) {
+	t.Setenv("ANA_TOKEN", "ana-token")
+	t.Setenv("YNABU_PROFILE", "bruno")
+
+	c, err := buildConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Profile != "bruno" || c.Manifest != "bruno.yaml" || c.YNAB.Token != "top-token" || c.Rules != "rules.yaml" {
+		t.Fatalf("YNABU_PROFILE not applied: %+v", c)
+	}
+
+	c, err = buildConfig(t, "--profile", "ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Profile != "ana" || c.YNAB.Token != "ana-token" || c.YNAB.BudgetID != "ana-budget" || c.Manifest != "" {
+		t.Fatalf("--profile not applied over YNABU_PROFILE: %+v", c)
+	}
+
+	// Switching profiles starts from the top-level settings, not from the
+	// selected profile.
+	top, err := c.WithProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.YNAB.Token != "top-token" || top.YNAB.BudgetID != "shared" {
+		t.Fatalf("top-level settings lost: %+v", top)
+	}
+	bruno, err := c.WithProfile("bruno")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bruno.YNAB.Token != "top-token" || bruno.Manifest != "bruno.yaml" {
+		t.Fatalf("profile built on the selected one: %+v", bruno)
+	}
+
+	if _, err := c.WithProfile("carla"); err == nil {
+		t.Fatal("expected an error for an unknown profile")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, c := range map[string]Config{
+		"negative batch size":    {BatchSize: -1},
+		"oauth without redirect": {OAuth: OAuthConfig{ClientID: "id", ClientSecret: "secret"}},
+		"oauth without secret":   {OAuth: OAuthConfig{ClientID: "id", RedirectURL: "https://ynabu.example.com/auth/callback"}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	c := Config{OAuth: OAuthConfig{ClientID: "id", ClientSecret: "secret", RedirectURL: "https://ynabu.example.com/auth/callback"}}
+	if err := c.Validate(); err != nil {
+		t.Errorf("valid config rejected: %v", err)
+	}
+}
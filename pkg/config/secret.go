@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Secret sources the ynab.token setting accepts besides a literal token or
+// $VAR expansion.
+const (
+	SourceFile    = "file"
+	SourceCmd     = "cmd"
+	SourceKeyring = "keyring"
+	SourceEnv     = "env"
+	SourceLiteral = "literal"
+)
+
+// keyringUser is the keyring entry read when a keyring source names only the
+// service.
+const keyringUser = "token"
+
+// secretCmdTimeout bounds how long a cmd: source may take, leaving time for
+// interactive unlock prompts of password managers.
+const secretCmdTimeout = 2 * time.Minute
+
+// ResolveSecret returns the secret a setting refers to:
+//
+//	file:/run/secrets/ynab        the contents of the file
+//	cmd:op read op://vault/ynab   the output of the command, run with sh -c
+//	keyring:ynabu                 the OS keyring entry "token" of service ynabu
+//	keyring:ynabu/ana             the entry "ana" of service ynabu
+//
+// Anything else is taken literally after $VAR expansion. Surrounding
+// whitespace is trimmed. Errors name the source but never the secret.
+func ResolveSecret(ref string) (string, error) {
+	kind, rest := SecretSource(ref)
+	switch kind {
+	case SourceFile:
+		data, err := os.ReadFile(rest)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case SourceCmd:
+		ctx, cancel := context.WithTimeout(context.Background(), secretCmdTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", rest)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command %q failed: %w: %s", rest, err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	case SourceKeyring:
+		service, user, ok := strings.Cut(rest, "/")
+		if !ok {
+			user = keyringUser
+		}
+		secret, err := keyring.Get(service, user)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("no keyring entry %q for service %q", user, service)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read keyring service %q: %w", service, err)
+		}
+		return strings.TrimSpace(secret), nil
+	default:
+		return strings.TrimSpace(os.ExpandEnv(ref)), nil
+	}
+}
+
+// SecretSource splits a setting into the kind of source it uses and what
+// follows the prefix.
+func SecretSource(ref string) (kind, rest string) {
+	for _, k := range []string{SourceFile, SourceCmd, SourceKeyring} {
+		if rest, ok := strings.CutPrefix(ref, k+":"); ok {
+			return k, strings.TrimSpace(rest)
+		}
+	}
+	if strings.Contains(ref, "$") {
+		return SourceEnv, ref
+	}
+	return SourceLiteral, ref
+}
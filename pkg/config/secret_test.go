@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestResolveSecret(t *testing.T) {
+	keyring.MockInit()
+	if err := keyring.Set("ynabu", "token", "from-keyring"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Set("ynabu", "ana", "ana-keyring"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ynab")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("YNAB_TEST_TOKEN", "from-env")
+
+	for ref, want := range map[string]string{
+		"file:" + path:         "from-file",
+		"cmd:echo from-cmd":    "from-cmd",
+		"keyring:ynabu":        "from-keyring",
+		"keyring:ynabu/ana":    "ana-keyring",
+		"$YNAB_TEST_TOKEN":     "from-env",
+		"literal-token":        "literal-token",
+		"cmd: printf ' x \\n'": "x",
+	} {
+		got, err := ResolveSecret(ref)
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", ref, got, want)
+		}
+	}
+
+	for _, ref := range []string{"file:" + path + ".missing", "cmd:echo s3cret >&2; exit 3", "keyring:other"} {
+		if _, err := ResolveSecret(ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
+
+func TestTokenSourceIsRecorded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ynab")
+	if err := os.WriteFile(path, []byte("from-file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var y YNABConfig
+	if err := y.resolveToken("file:" + path); err != nil {
+		t.Fatal(err)
+	}
+	if y.Token != "from-file" || y.TokenSource != SourceFile {
+		t.Fatalf("got token %q from %q", y.Token, y.TokenSource)
+	}
+	if err := y.resolveToken("file:/nonexistent/ynab"); err == nil || strings.Contains(err.Error(), "from-file") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestYNABConfigRedactsToken(t *testing.T) {
+	y := YNABConfig{BudgetID: "b", Token: "s3cret", TokenSource: SourceLiteral}
+	if s := fmt.Sprintf("%v %+v", y, y); strings.Contains(s, "s3cret") {
+		t.Fatalf("token printed: %s", s)
+	}
+}
+
+func TestSessionKeyFromEnv(t *testing.T) {
+	t.Setenv("SESSION_KEY", "k")
+	c, err := Build(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SessionKey != "k" {
+		t.Fatalf("session key %q, want k", c.SessionKey)
+	}
+}
@@ -1,9 +1,14 @@
 package executors
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/journal"
 	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
 )
 
 // Apply creates the missing transactions for a single statement. The heavy
@@ -11,47 +16,316 @@ import (
 // effects required to bring the account in sync. The caller is responsible for
 // looping over multiple statements.
 func (e *Executor) Apply(statement *models.Statement) error {
-	e.logger.Debug("applying statement", "file", statement.FilePath)
+	e.logger.Debug("applying statement", "file", statement.Name())
 
-	// Parse local transactions
-	localTxs, err := statement.Transactions(e.parser)
+	report, err := e.reconcile(statement)
 	if err != nil {
 		return err
 	}
 
-	if statement.AccountID == "" {
-		return fmt.Errorf("statement %s missing account_id", statement.FilePath)
+	e.logger.Info("transactions to create", "count", report.MissingCount(), "budget", report.BudgetLabel(), "account_id", report.AccountID)
+
+	if report.MissingCount() == 0 {
+		return nil // nothing to do
 	}
 
-	// Fetch remote transactions for the account
-	remoteTxs, err := e.ynab.Transaction().GetTransactionsByAccount(statement.BudgetID, statement.AccountID, nil)
+	step, err := report.Step()
 	if err != nil {
 		return err
 	}
+	return e.execute(step, nil)
+}
 
-	report := BuildReport(localTxs, remoteTxs, e.config.UseCustomID)
+// Progress is reported by an executor with OnProgress after every batch of
+// creates of a step.
+type Progress struct {
+	File      string `json:"file"`
+	AccountID string `json:"account_id"`
+	// Chunk is the batch just sent, out of Chunks.
+	Chunk  int `json:"chunk"`
+	Chunks int `json:"chunks"`
+	// Created counts the transactions created so far, out of Total;
+	// Rejected those YNAB refused, with partial applies.
+	Created  int `json:"created"`
+	Total    int `json:"total"`
+	Rejected int `json:"rejected,omitempty"`
+}
 
-	toSync := report.TransactionsToSync()
-	e.logger.Info("transactions to create", "count", len(toSync), "account_id", statement.AccountID)
+// ApplyStep executes exactly the changes recorded in a saved plan step. The
+// account is fetched again first and, if its transactions no longer match the
+// fingerprint the step was computed against, ErrStalePlan is returned and
+// nothing is changed.
+func (e *Executor) ApplyStep(step *PlanStep) error {
+	e.logger.Debug("applying saved plan step", "file", step.File, "account_id", step.AccountID)
 
-	if len(toSync) == 0 {
+	if len(step.Changes) == 0 {
 		return nil // nothing to do
 	}
 
-	ts := e.ynab.Transaction()
-	batch, err := report.Payloads(statement.AccountID)
+	remoteTxs, err := e.check(step)
 	if err != nil {
 		return err
 	}
-	if len(batch) == 0 {
-		e.logger.Info("no valid transactions to create after filtering")
-		return nil // safety check
+
+	return e.execute(step, remoteTxs)
+}
+
+// ApplySteps executes saved plan steps like ApplyStep, but checks them all
+// before changing anything, so steps sharing an account, such as two cards
+// of a fatura paid from it, do not find it stale because of each other.
+// before, when not nil, is called ahead of every step; the first step that
+// fails stops the others.
+func (e *Executor) ApplySteps(steps []*PlanStep, before func(*PlanStep)) error {
+	remotes := make([][]*ynab.Transaction, len(steps))
+	for i, step := range steps {
+		remote, err := e.check(step)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.File, err)
+		}
+		remotes[i] = remote
 	}
-	e.logger.Info("sending batch to YNAB API", "count", len(batch), "account_id", statement.AccountID)
-	if err := ts.CreateTransactions(statement.BudgetID, batch); err != nil {
-		return fmt.Errorf("failed to create transactions: %w", err)
+	for i, step := range steps {
+		if before != nil {
+			before(step)
+		}
+		if len(step.Changes) == 0 {
+			continue
+		}
+		if err := e.execute(step, remotes[i]); err != nil {
+			return fmt.Errorf("%s: %w", step.File, err)
+		}
 	}
-	e.logger.Info("created transactions", "count", len(batch), "account_id", statement.AccountID)
+	return nil
+}
+
+// ApplyPlan executes saved plan steps that may belong to different
+// executors, such as the profiles of a manifest, with executorFor picking the
+// executor of each step. As with ApplySteps, every step is checked before
+// anything changes. Steps YNAB partly rejected in a partial apply do not stop
+// the others; their *CreateError values are returned together at the end.
+// Any other failure stops the plan and is returned alone.
+func ApplyPlan(steps []*PlanStep, executorFor func(*PlanStep) (*Executor, error)) error {
+	execs := make([]*Executor, len(steps))
+	remotes := make([][]*ynab.Transaction, len(steps))
+	for i, step := range steps {
+		e, err := executorFor(step)
+		if err != nil {
+			return err
+		}
+		if len(step.Changes) == 0 {
+			continue
+		}
+		remote, err := e.check(step)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.File, err)
+		}
+		execs[i], remotes[i] = e, remote
+	}
+
+	var rejected []error
+	for i, step := range steps {
+		if execs[i] == nil {
+			continue // nothing to do
+		}
+		execs[i].logger.Debug("applying saved plan step", "file", step.File, "account_id", step.AccountID)
+		if err := execs[i].execute(step, remotes[i]); err != nil {
+			var partial *CreateError
+			if !errors.As(err, &partial) {
+				return fmt.Errorf("%s: %w", step.File, err)
+			}
+			rejected = append(rejected, err)
+		}
+	}
+	return errors.Join(rejected...)
+}
 
+// CheckStep returns ErrStalePlan when the account of a saved plan step
+// changed since the step was computed, without changing anything. It lets
+// callers applying several steps refuse them all up front.
+func (e *Executor) CheckStep(step *PlanStep) error {
+	_, err := e.check(step)
+	return err
+}
+
+// check fetches the remote transactions a step was computed against and
+// compares them with its fingerprint.
+func (e *Executor) check(step *PlanStep) ([]*ynab.Transaction, error) {
+	remoteTxs, err := e.remote(step.BudgetID, step.AccountID, step.Since)
+	if err != nil {
+		return nil, err
+	}
+	if Fingerprint(remoteTxs) != step.Fingerprint {
+		return nil, fmt.Errorf("%w (file %s, account %s)", ErrStalePlan, step.File, step.AccountID)
+	}
+	return remoteTxs, nil
+}
+
+// execute sends the changes of a step to YNAB: creates and updates are
+// batched, deletes go one by one. remote is the current state of the account,
+// used to journal what updated and deleted transactions looked like before.
+func (e *Executor) execute(step *PlanStep, remote []*ynab.Transaction) error {
+	before := make(map[string]*transaction.Transaction, len(remote))
+	for _, rt := range remote {
+		before[rt.ID] = rt.Transaction
+	}
+
+	var creates []Change
+	var updates []transaction.PayloadTransaction
+	var deletes []string
+	for _, c := range step.Changes {
+		switch c.Action {
+		case ActionCreate:
+			creates = append(creates, c)
+		case ActionUpdate:
+			updates = append(updates, *c.Payload)
+		case ActionDelete:
+			deletes = append(deletes, c.TransactionID)
+		default:
+			return fmt.Errorf("unknown plan action %q", c.Action)
+		}
+	}
+
+	ts := e.ynab
+	// Rejected creates only stop the step when partial applies are off;
+	// otherwise they are reported once everything else went through, or
+	// together with whatever failed next.
+	createErr := e.create(step, creates)
+	var rejected *CreateError
+	if createErr != nil && !errors.As(createErr, &rejected) {
+		return createErr
+	}
+	if len(updates) > 0 {
+		if _, err := ts.UpdateTransactions(step.BudgetID, updates); err != nil {
+			return errors.Join(createErr, fmt.Errorf("failed to update transactions: %w", err))
+		}
+		for _, p := range updates {
+			e.record(step, ActionUpdate, p.ID, before[p.ID])
+		}
+		e.logger.Info("updated transactions", "count", len(updates), "account_id", step.AccountID)
+	}
+	for _, id := range deletes {
+		if err := ts.DeleteTransaction(step.BudgetID, id); err != nil {
+			return errors.Join(createErr, fmt.Errorf("failed to delete transaction %s: %w", id, err))
+		}
+		e.record(step, ActionDelete, id, before[id])
+	}
+	if len(deletes) > 0 {
+		e.logger.Info("deleted transactions", "count", len(deletes), "account_id", step.AccountID)
+	}
+
+	return createErr
+}
+
+// create sends the create changes of a step in chunks of the configured
+// batch size. A chunk YNAB rejects as invalid aborts the step unless partial
+// applies are enabled; then the chunk is bisected so every valid transaction
+// is still created, and the rejected ones are returned in a *CreateError.
+func (e *Executor) create(step *PlanStep, changes []Change) error {
+	size := e.batchSize()
+	chunks := (len(changes) + size - 1) / size
+	var failures []Failure
+	created := 0
+	for i := 0; i < chunks; i++ {
+		chunk := changes[i*size : min((i+1)*size, len(changes))]
+		e.logger.Info("sending batch to YNAB API", "count", len(chunk), "chunk", fmt.Sprintf("%d/%d", i+1, chunks), "account_id", step.AccountID)
+		err := e.createChunk(step, chunk)
+		if err != nil {
+			if !e.config.Partial || !isRejection(err) {
+				return fmt.Errorf("failed to create transactions (%s): %w", lineList(chunk), err)
+			}
+			e.logger.Warn("YNAB rejected a batch, isolating the invalid transactions", "lines", lineList(chunk), "error", err)
+			rejected := e.bisect(step, chunk, err)
+			failures = append(failures, rejected...)
+			created -= len(rejected)
+		}
+		created += len(chunk)
+		if e.progress != nil {
+			e.progress(Progress{File: step.File, AccountID: step.AccountID, Chunk: i + 1, Chunks: chunks, Created: created, Total: len(changes), Rejected: len(failures)})
+		}
+	}
+	if len(failures) > 0 {
+		return &CreateError{File: step.File, Failures: failures}
+	}
+	return nil
+}
+
+// createChunk creates one batch of transactions, journaling the new IDs and
+// warning about the ones YNAB skipped because their import_id already exists.
+func (e *Executor) createChunk(step *PlanStep, chunk []Change) error {
+	payloads := make([]transaction.PayloadTransaction, len(chunk))
+	for i, c := range chunk {
+		payloads[i] = *c.Payload
+	}
+	summary, err := e.ynab.CreateTransactions(step.BudgetID, payloads)
+	if err != nil {
+		return err
+	}
+	for _, id := range summary.TransactionIDs {
+		e.record(step, ActionCreate, id, nil)
+	}
+
+	if len(summary.DuplicateImportIDs) > 0 {
+		dupes := make(map[string]bool, len(summary.DuplicateImportIDs))
+		for _, id := range summary.DuplicateImportIDs {
+			dupes[id] = true
+		}
+		var skipped []Change
+		for _, c := range chunk {
+			if c.Payload.ImportID != nil && dupes[*c.Payload.ImportID] {
+				skipped = append(skipped, c)
+			}
+		}
+		e.logger.Warn("YNAB skipped transactions whose import_id already exists", "count", len(summary.DuplicateImportIDs), "lines", lineList(skipped), "account_id", step.AccountID)
+	}
+
+	e.logger.Info("created transactions", "count", len(summary.TransactionIDs), "account_id", step.AccountID)
 	return nil
 }
+
+// bisect splits a rejected chunk in halves until the offending changes are
+// isolated, creating the valid ones along the way.
+func (e *Executor) bisect(step *PlanStep, chunk []Change, err error) []Failure {
+	if len(chunk) == 1 {
+		return []Failure{{Change: chunk[0], Err: err}}
+	}
+
+	var failures []Failure
+	mid := len(chunk) / 2
+	for _, half := range [][]Change{chunk[:mid], chunk[mid:]} {
+		err := e.createChunk(step, half)
+		switch {
+		case err == nil:
+		case isRejection(err):
+			failures = append(failures, e.bisect(step, half, err)...)
+		default:
+			// Not the payloads' fault (network, quota...): give up on the
+			// whole half rather than hammering the API.
+			for _, c := range half {
+				failures = append(failures, Failure{Change: c, Err: err})
+			}
+		}
+	}
+	return failures
+}
+
+func (e *Executor) batchSize() int {
+	if e.config.BatchSize > 0 {
+		return e.config.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+// record adds a change to the journal run, if any.
+func (e *Executor) record(step *PlanStep, action Action, id string, before *transaction.Transaction) {
+	if e.run == nil {
+		return
+	}
+	e.run.Add(journal.Record{
+		Profile:       e.config.Profile,
+		BudgetID:      step.BudgetID,
+		AccountID:     step.AccountID,
+		Action:        string(action),
+		TransactionID: id,
+		Before:        before,
+	})
+}
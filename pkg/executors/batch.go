@@ -0,0 +1,68 @@
+package executors
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brunomvsouza/ynab.go/api"
+)
+
+// DefaultBatchSize is how many transactions are created per request when the
+// config does not set batch_size.
+const DefaultBatchSize = 100
+
+// Failure is a change YNAB refused to apply.
+type Failure struct {
+	Change Change
+	Err    error
+}
+
+// CreateError lists the transactions of a step YNAB rejected during a
+// partial apply. Every other change of the step was applied.
+type CreateError struct {
+	File     string
+	Failures []Failure
+}
+
+func (e *CreateError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d transaction(s) from %s were rejected by YNAB:", len(e.Failures), e.File)
+	for _, f := range e.Failures {
+		b.WriteString("\n  ")
+		if f.Change.Line > 0 {
+			fmt.Fprintf(&b, "line %d: ", f.Change.Line)
+		}
+		if p := f.Change.Payload; p != nil {
+			payee := ""
+			if p.PayeeName != nil {
+				payee = *p.PayeeName
+			}
+			fmt.Fprintf(&b, "%s %s %.2f: ", p.Date.Format("2006/01/02"), payee, float64(p.Amount)/1000.0)
+		}
+		b.WriteString(f.Err.Error())
+	}
+	return b.String()
+}
+
+// isRejection reports whether YNAB refused a request because of its content
+// (HTTP 400), as opposed to a transient or account-wide problem.
+func isRejection(err error) bool {
+	var apiErr *api.Error
+	return errors.As(err, &apiErr) && strings.HasPrefix(apiErr.ID, "400")
+}
+
+// lineList describes which statement lines a set of changes comes from.
+func lineList(changes []Change) string {
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		if c.Line > 0 {
+			lines = append(lines, strconv.Itoa(c.Line))
+		}
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("%d transaction(s)", len(changes))
+	}
+	return "lines " + strings.Join(lines, ", ")
+}
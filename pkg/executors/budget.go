@@ -0,0 +1,33 @@
+package executors
+
+import (
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// Where the budget of a statement came from, in the order BudgetRef tries
+// them.
+const (
+	BudgetFromStatement = "statement"
+	BudgetFromManifest  = "manifest"
+	BudgetFromConfig    = "config"
+	BudgetFromLastUsed  = "last-used"
+)
+
+// BudgetRef returns the budget (ID or name) a statement is reconciled
+// against and where it came from: the statement itself, the manifest
+// default, the configured budget, or YNAB's last-used budget. Plan, Apply
+// and the server all go through it so they always agree.
+func BudgetRef(statement *models.Statement, cfg *config.Config) (ref, source string) {
+	switch {
+	case statement.BudgetRef() != "":
+		return statement.BudgetRef(), BudgetFromStatement
+	case statement.DefaultBudget != "":
+		return statement.DefaultBudget, BudgetFromManifest
+	case cfg != nil && cfg.YNAB.BudgetID != "":
+		return cfg.YNAB.BudgetID, BudgetFromConfig
+	default:
+		return ynab.LastUsedBudget, BudgetFromLastUsed
+	}
+}
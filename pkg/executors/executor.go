@@ -3,6 +3,7 @@ package executors
 import (
 	"github.com/charmbracelet/log"
 	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/journal"
 	"github.com/yurifrl/ynabu/pkg/parser"
 	"github.com/yurifrl/ynabu/pkg/ynab"
 )
@@ -10,15 +11,34 @@ import (
 type Executor struct {
     logger *log.Logger
     config *config.Config
-    ynab   *ynab.YNABClient
+    ynab   ynab.Client
     parser *parser.Parser
+    run    *journal.Run
+    // progress, when set, is told about every batch of creates sent.
+    progress func(Progress)
+    // resolve turns budget and account names into IDs, caching listings
+    // for the lifetime of the executor.
+    resolve *ynab.Resolver
 }
 
-func New(logger *log.Logger, config *config.Config, ynab *ynab.YNABClient) *Executor {
+func New(logger *log.Logger, config *config.Config, client ynab.Client) *Executor {
     return &Executor{
-        logger: logger,
-        config: config,
-        ynab:   ynab,
-        parser: parser.New(logger),
+        logger:  logger,
+        config:  config,
+        ynab:    client,
+        parser:  parser.New(logger),
+        resolve: ynab.NewResolver(client),
     }
 }
+
+// Journal makes the executor record every remote change it performs into
+// run, so it can be undone later. A nil run disables journaling.
+func (e *Executor) Journal(run *journal.Run) {
+	e.run = run
+}
+
+// OnProgress makes the executor call fn after every batch of transactions it
+// creates, so long applies can be followed live. nil disables it.
+func (e *Executor) OnProgress(fn func(Progress)) {
+	e.progress = fn
+}
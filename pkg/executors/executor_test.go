@@ -0,0 +1,465 @@
+package executors
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+	"github.com/charmbracelet/log"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/journal"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab/fake"
+)
+
+const extrato = `17/03/2025;PIX TRANSF ID_A15/03;-2327,00
+17/03/2025;MOBILE PAG TIT 426XXXXXX;-287,00
+19/03/2025;PIX TRANSF ID_C19/03;-1900,00`
+
+// newTestExecutor returns an executor backed by a fake with one budget and
+// one account, and a statement file holding the three extrato lines above.
+func newTestExecutor(t *testing.T) (*Executor, *fake.Client, *models.Statement) {
+	t.Helper()
+
+	client := fake.New()
+	client.AddBudget("budget-1", "Family")
+	client.AddAccount("budget-1", "account-1", "Itaú Conta Corrente")
+
+	path := filepath.Join(t.TempDir(), "extrato.txt")
+	if err := os.WriteFile(path, []byte(extrato), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{UseCustomID: true, YNAB: config.YNABConfig{BudgetID: "budget-1"}}
+	exec := New(log.New(os.Stderr), cfg, client)
+	return exec, client, &models.Statement{FilePath: path, BudgetID: "budget-1", AccountID: "account-1"}
+}
+
+func TestPlanApplyRoundTrip(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+
+	report, err := exec.Plan(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MissingCount() != 3 || report.InSyncCount() != 0 {
+		t.Fatalf("first plan: to_add=%d in_sync=%d, want 3/0", report.MissingCount(), report.InSyncCount())
+	}
+
+	if err := exec.Apply(st); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 3 {
+		t.Fatalf("expected 3 remote transactions after apply, got %d", got)
+	}
+
+	report, err = exec.Plan(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MissingCount() != 0 || report.InSyncCount() != 3 {
+		t.Fatalf("second plan: to_add=%d in_sync=%d, want 0/3", report.MissingCount(), report.InSyncCount())
+	}
+
+	// Applying again is a no-op.
+	if err := exec.Apply(st); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Calls("CreateTransactions"); got != 1 {
+		t.Errorf("CreateTransactions called %d times, want 1", got)
+	}
+}
+
+func TestApplyStepRefusesStalePlan(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+
+	report, err := exec.Plan(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err := report.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone adds a transaction in YNAB between plan and apply.
+	date, _ := api.DateFromString("2025-03-20")
+	client.AddTransaction("budget-1", &transaction.Transaction{AccountID: "account-1", Date: date, Amount: -1000})
+
+	if err := exec.ApplyStep(step); !errors.Is(err, ErrStalePlan) {
+		t.Fatalf("expected ErrStalePlan, got %v", err)
+	}
+	if got := client.Calls("CreateTransactions"); got != 0 {
+		t.Errorf("stale plan created transactions")
+	}
+
+	// A fresh plan applies cleanly.
+	report, _ = exec.Plan(st)
+	step, _ = report.Step()
+	if err := exec.ApplyStep(step); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyPartOfAStep(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+
+	report, err := exec.Plan(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err := report.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.CheckStep(step); err != nil {
+		t.Fatal(err)
+	}
+
+	part := step.Without([]string{step.Changes[1].LocalID})
+	if len(part.Changes) != 2 || len(step.Changes) != 3 {
+		t.Fatalf("expected 2 of 3 changes, got %d of %d", len(part.Changes), len(step.Changes))
+	}
+	if err := exec.ApplyStep(part); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 2 {
+		t.Fatalf("expected 2 remote transactions, got %d", got)
+	}
+	// The rest of the plan is stale now.
+	if err := exec.CheckStep(step); !errors.Is(err, ErrStalePlan) {
+		t.Fatalf("expected ErrStalePlan, got %v", err)
+	}
+}
+
+func TestApplyStepsOfOneAccount(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+
+	report, err := exec.Plan(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err := report.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two steps computed against the same account, like two cards of a
+	// fatura paid from it.
+	first := step.Without([]string{step.Changes[2].LocalID})
+	second := step.Without([]string{step.Changes[0].LocalID, step.Changes[1].LocalID})
+
+	var applied []*PlanStep
+	if err := exec.ApplySteps([]*PlanStep{first, second}, func(s *PlanStep) { applied = append(applied, s) }); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 3 || len(applied) != 2 {
+		t.Fatalf("expected 3 remote transactions from 2 steps, got %d from %d", got, len(applied))
+	}
+
+	// Stale steps are all refused before anything is created.
+	if err := exec.ApplySteps([]*PlanStep{first, second}, nil); !errors.Is(err, ErrStalePlan) {
+		t.Fatalf("expected ErrStalePlan, got %v", err)
+	}
+	if got := client.Calls("CreateTransactions"); got != 2 {
+		t.Errorf("expected no more creates, got %d calls", got)
+	}
+}
+
+func TestApplySavedPlanOfOneAccount(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+	// A second profile syncing another statement into the same account.
+	other := New(log.New(os.Stderr), &config.Config{Profile: "other", UseCustomID: true}, client)
+
+	lines := strings.Split(extrato, "\n")
+	second := filepath.Join(t.TempDir(), "extrato-2.txt")
+	if err := os.WriteFile(second, []byte(lines[2]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(st.FilePath, []byte(strings.Join(lines[:2], "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var steps []*PlanStep
+	for _, p := range []struct {
+		exec *Executor
+		st   *models.Statement
+	}{
+		{exec, st},
+		{other, &models.Statement{FilePath: second, BudgetID: "budget-1", AccountID: "account-1"}},
+	} {
+		report, err := p.exec.Plan(p.st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, err := report.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, step)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := WritePlanFile(path, steps); err != nil {
+		t.Fatal(err)
+	}
+	pf, err := ReadPlanFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executorFor := func(step *PlanStep) (*Executor, error) {
+		if step.Profile == "other" {
+			return other, nil
+		}
+		return exec, nil
+	}
+	if err := ApplyPlan(pf.Steps, executorFor); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 3 {
+		t.Fatalf("expected 3 remote transactions, got %d", got)
+	}
+
+	// Applied again, both steps are stale and nothing is created.
+	if err := ApplyPlan(pf.Steps, executorFor); !errors.Is(err, ErrStalePlan) {
+		t.Fatalf("expected ErrStalePlan, got %v", err)
+	}
+	if got := client.Calls("CreateTransactions"); got != 2 {
+		t.Errorf("expected no more creates, got %d calls", got)
+	}
+}
+
+func TestApplyReportsProgress(t *testing.T) {
+	exec, _, st := newTestExecutor(t)
+	exec.config.BatchSize = 2
+
+	var got []Progress
+	exec.OnProgress(func(p Progress) { got = append(got, p) })
+	if err := exec.Apply(st); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Created != 2 || got[1].Created != 3 || got[1].Total != 3 || got[1].Chunks != 2 {
+		t.Fatalf("unexpected progress %+v", got)
+	}
+}
+
+func TestUndoRevertsJournaledApply(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+
+	j, err := journal.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := j.Begin(journal.KindApply)
+	exec.Journal(run)
+	if err := exec.Apply(st); err != nil {
+		t.Fatal(err)
+	}
+	exec.Journal(nil)
+
+	if run.Count(string(ActionCreate)) != 3 {
+		t.Fatalf("journal recorded %d creates, want 3", run.Count(string(ActionCreate)))
+	}
+
+	steps, err := exec.PlanUndo(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Count(ActionDelete) != 3 {
+		t.Fatalf("unexpected undo plan %+v", steps)
+	}
+	if err := exec.ApplyStep(steps[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tx := range client.Transactions("budget-1", "account-1") {
+		if !tx.Deleted {
+			t.Errorf("transaction %s was not deleted by undo", tx.ID)
+		}
+	}
+	report, _ := exec.Plan(st)
+	if report.MissingCount() != 3 {
+		t.Errorf("after undo plan has %d to add, want 3", report.MissingCount())
+	}
+}
+
+func TestUndoRecreatesDeletedTransactionsWithoutImportID(t *testing.T) {
+	exec, client, _ := newTestExecutor(t)
+
+	importID, memo := "YNAB:-287000:2025-03-17:1", "bank import"
+	tx := client.AddTransaction("budget-1", &transaction.Transaction{AccountID: "account-1", Date: api.Date{Time: time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)}, Amount: -287000, Memo: &memo, ImportID: &importID})
+	before := *tx
+	if err := client.DeleteTransaction("budget-1", tx.ID); err != nil {
+		t.Fatal(err)
+	}
+	run := &journal.Run{ID: "run-1", Records: []journal.Record{{BudgetID: "budget-1", AccountID: "account-1", Action: string(ActionDelete), TransactionID: tx.ID, Before: &before}}}
+
+	steps, err := exec.PlanUndo(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Count(ActionCreate) != 1 {
+		t.Fatalf("unexpected undo plan %+v", steps)
+	}
+	if err := exec.ApplyStep(steps[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	var recreated []*transaction.Transaction
+	for _, rt := range client.Transactions("budget-1", "account-1") {
+		if !rt.Deleted {
+			recreated = append(recreated, rt)
+		}
+	}
+	if len(recreated) != 1 || recreated[0].ImportID != nil || recreated[0].Amount != -287000 || *recreated[0].Memo != memo {
+		t.Fatalf("expected the transaction to be created again without its import_id, got %+v", recreated)
+	}
+}
+
+// rejectingStep plans the test statement and makes YNAB reject its second
+// transaction by giving it an overlong payee.
+func rejectingStep(t *testing.T, exec *Executor, st *models.Statement) *PlanStep {
+	t.Helper()
+	report, err := exec.Plan(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err := report.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 201)
+	step.Changes[1].Payload.PayeeName = &long
+	return step
+}
+
+func TestPartialApplyReportsRejectionsWithLaterFailures(t *testing.T) {
+	exec, _, st := newTestExecutor(t)
+	exec.config.BatchSize = 2
+	exec.config.Partial = true
+	step := rejectingStep(t, exec, st)
+	step.Changes = append(step.Changes, Change{Action: ActionDelete, TransactionID: "gone"})
+
+	err := exec.ApplyStep(step)
+	var rejected *CreateError
+	if !errors.As(err, &rejected) || len(rejected.Failures) != 1 {
+		t.Fatalf("expected the rejected create to be reported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed to delete transaction gone") {
+		t.Errorf("the failed delete is missing from %q", err)
+	}
+}
+
+func TestPartialApplyIsolatesRejectedTransactions(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+	exec.config.BatchSize = 2
+	exec.config.Partial = true
+	step := rejectingStep(t, exec, st)
+
+	err := exec.ApplyStep(step)
+	var rejected *CreateError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected a CreateError, got %v", err)
+	}
+	if len(rejected.Failures) != 1 || rejected.Failures[0].Change.Line != step.Changes[1].Line {
+		t.Fatalf("expected only the second transaction to be rejected, got %+v", rejected.Failures)
+	}
+	if !strings.Contains(err.Error(), "payee_name is too long") {
+		t.Errorf("the rejection reason is missing from %q", err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 2 {
+		t.Fatalf("expected the 2 valid transactions to be created, got %d", got)
+	}
+}
+
+func TestApplyStopsAtRejectedBatchByDefault(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+	exec.config.BatchSize = 1
+	step := rejectingStep(t, exec, st)
+
+	err := exec.ApplyStep(step)
+	var rejected *CreateError
+	if err == nil || errors.As(err, &rejected) {
+		t.Fatalf("expected a plain error, got %v", err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 1 {
+		t.Fatalf("expected only the batch before the rejected one to be created, got %d", got)
+	}
+}
+
+func TestApplyResolvesNames(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+	st.BudgetID, st.AccountID = "", ""
+	st.Budget, st.Account = "Family", "itaú conta corrente"
+
+	if err := exec.Apply(st); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 3 {
+		t.Fatalf("expected 3 remote transactions after apply, got %d", got)
+	}
+}
+
+// TestPlanAndApplyUseTheSameBudget guards against plan and apply falling back
+// to different budgets when a statement names none.
+func TestPlanAndApplyUseTheSameBudget(t *testing.T) {
+	for _, tc := range []struct {
+		name, manifestBudget, wantBudget, wantSource string
+	}{
+		{"config", "", "budget-1", BudgetFromConfig},
+		{"manifest", "Work", "budget-2", BudgetFromManifest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exec, client, st := newTestExecutor(t)
+			client.AddBudget("budget-2", "Work")
+			client.AddAccount("budget-2", "account-2", "Itaú Conta Corrente")
+			st.BudgetID, st.AccountID = "", ""
+			st.Account, st.DefaultBudget = "Itaú Conta Corrente", tc.manifestBudget
+
+			report, err := exec.Plan(st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.BudgetID != tc.wantBudget || report.BudgetSource != tc.wantSource {
+				t.Fatalf("plan used budget %s from %s, want %s from %s", report.BudgetID, report.BudgetSource, tc.wantBudget, tc.wantSource)
+			}
+			if err := exec.Apply(st); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(client.Transactions(report.BudgetID, report.AccountID)); got != 3 {
+				t.Fatalf("expected apply to create 3 transactions in the planned budget, got %d", got)
+			}
+		})
+	}
+}
+
+func TestStatementOptions(t *testing.T) {
+	exec, client, st := newTestExecutor(t)
+	approved := false
+	st.Cleared = "uncleared"
+	st.Approved = &approved
+	st.Filter.Payee.Exclude = []string{"mobile pag"}
+
+	if err := exec.Apply(st); err != nil {
+		t.Fatal(err)
+	}
+	txs := client.Transactions("budget-1", "account-1")
+	if len(txs) != 2 {
+		t.Fatalf("expected the excluded payee to be skipped, got %d transactions", len(txs))
+	}
+	for _, tx := range txs {
+		if tx.Cleared != transaction.ClearingStatusUncleared || tx.Approved {
+			t.Errorf("expected uncleared, unapproved transactions, got %s/%v", tx.Cleared, tx.Approved)
+		}
+	}
+
+	st.Cleared = "maybe"
+	if _, err := exec.Plan(st); err == nil {
+		t.Error("expected an invalid cleared status to be rejected")
+	}
+}
@@ -2,57 +2,155 @@ package executors
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
 
-	"github.com/charmbracelet/lipgloss"
 	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
 )
 
-// Plan generates a reconciliation report for a single statement and prints a
-// human-readable preview. It is a thin, side-effecting wrapper around the pure
-// BuildReport function – all heavy lifting is delegated there.  The caller is
-// responsible for looping over multiple statements when needed.
-func (e *Executor) Plan(statement *models.Statement) error {
-    e.logger.Debug("planning statement", "file", statement.FilePath)
+// sinceMargin widens the remote window before the earliest statement date so
+// transactions whose date was edited in YNAB still match.
+const sinceMargin = 30 * 24 * time.Hour
+
+// Plan generates a reconciliation report for a single statement. It is a thin
+// wrapper around the pure BuildReport function – all heavy lifting is
+// delegated there. Plan does not print anything: callers format the report
+// with Render (CLI) or View (JSON APIs). The caller is responsible for looping
+// over multiple statements when needed.
+//
+// The returned report can be turned into a saved plan with Report.Step.
+func (e *Executor) Plan(statement *models.Statement) (*Report, error) {
+    e.logger.Debug("planning statement", "file", statement.Name())
 
-    // Parse local transactions
-    localTxs, err := statement.Transactions(e.parser)
+    report, err := e.reconcile(statement)
     if err != nil {
-        return err
+        return nil, err
     }
 
-    if statement.AccountID == "" {
-        return fmt.Errorf("statement %s missing account_id", statement.FilePath)
-    }
+    e.logger.Debug("processing plan report", "total", len(report.Items), "in_sync", report.InSyncCount(), "to_add", report.MissingCount())
 
-    // Fetch remote transactions for the account
-    remoteTxs, err := e.ynab.Transaction().GetTransactionsByAccount(e.config.YNAB.BudgetID, statement.AccountID, nil)
-    if err != nil {
-        return err
-    }
+    return report, nil
+}
 
-    report := BuildReport(localTxs, remoteTxs, e.config.UseCustomID)
+// reconcile parses the statement, fetches the remote transactions of its
+// account from the budget BudgetRef picks and builds the reconciliation
+// report, recording on it where it was computed and a fingerprint of the
+// remote state it saw.
+func (e *Executor) reconcile(statement *models.Statement) (*Report, error) {
+	files, err := statement.Files()
+	if err != nil {
+		return nil, &StatementError{Err: err}
+	}
+	if len(files) != 1 || files[0] != statement.Name() {
+		e.logger.Info("statement files matched", "file", statement.Name(), "select", statement.Select, "files", files)
+	}
 
-    e.logger.Debug("processing plan report", "total", len(report.Items), "in_sync", report.InSyncCount(), "to_add", report.MissingCount())
+	// Parse local transactions
+	localTxs, err := LoadTransactions(e.parser, statement, files)
+	if err != nil {
+		return nil, err
+	}
+	cleared, err := clearingStatus(statement)
+	if err != nil {
+		return nil, err
+	}
 
-    syncedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))  // gray
-    addedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))  // green
+	if statement.AccountRef() == "" {
+		return nil, &StatementError{Err: fmt.Errorf("statement %s missing account or account_id", statement.Name())}
+	}
+	budgetRef, budgetSource := BudgetRef(statement, e.config)
+	budgetID, err := e.resolve.Budget(budgetRef)
+	if err != nil {
+		return nil, fmt.Errorf("statement %s: %w", statement.Name(), err)
+	}
+	e.logger.Debug("budget resolved", "file", statement.Name(), "budget", budgetRef, "budget_id", budgetID, "source", budgetSource)
+	accountID, err := e.resolve.Account(budgetID, statement.AccountRef())
+	if err != nil {
+		return nil, fmt.Errorf("statement %s: %w", statement.Name(), err)
+	}
 
-    for _, m := range report.Items {
-        if m.Status == Synced {
-            line := fmt.Sprintf("%s | %-30s | %s | %s | R$ %.2f", m.Local.Date(), m.Local.Payee(), m.Local.ID(), m.Remote.CustomID(), m.Local.Amount())
-            fmt.Println(syncedStyle.Render("= " + line))
-            continue // nothing to add
-        }
+	// Fetch remote transactions for the account, starting a little before
+	// the statement does.
+	since, err := SinceDate(localTxs)
+	if err != nil {
+		return nil, &StatementError{Err: err, Parse: true}
+	}
+	remoteTxs, err := e.remote(budgetID, accountID, since)
+	if err != nil {
+		return nil, err
+	}
 
-        line := fmt.Sprintf("%s | %-30s | %s | %s | R$ %.2f", m.Local.Date(), m.Local.Payee(), m.Local.ID(), "xxxxxxxxxxxxxxxx", m.Local.Amount())
-        fmt.Println(addedStyle.Render("+ " + line))
-    }
+	report := BuildReport(localTxs, remoteTxs, e.config.UseCustomID)
+	report.File = statement.Name()
+	report.Files = files
+	report.BudgetID = budgetID
+	report.BudgetName = e.resolve.BudgetName(budgetID)
+	report.BudgetSource = budgetSource
+	report.Profile = e.config.Profile
+	report.AccountID = accountID
+	report.Cards = cardsLabel(statement.Filter)
+	report.Fingerprint = Fingerprint(remoteTxs)
+	report.Since = since
+	report.Cleared = cleared
+	report.Approved = statement.Approved
 
-    if report.MissingCount() == 0 {
-        fmt.Printf("\nPlan: All %d transaction(s) are in sync\n", report.InSyncCount())
-    } else {
-        fmt.Printf("\nPlan: %d transaction(s) will be added, %d already in sync\n", report.MissingCount(), report.InSyncCount())
-    }
+	return report, nil
+}
+
+// remote fetches the transactions of an account on or after since
+// (YYYY-MM-DD, empty for the whole history).
+func (e *Executor) remote(budgetID, accountID, since string) ([]*ynab.Transaction, error) {
+	filter, err := SinceFilter(since)
+	if err != nil {
+		return nil, err
+	}
+	return e.ynab.GetTransactionsByAccount(budgetID, accountID, filter)
+}
+
+// SinceFilter turns a since date (YYYY-MM-DD) into a transaction filter; an
+// empty date yields a nil filter.
+func SinceFilter(since string) (*transaction.Filter, error) {
+	if since == "" {
+		return nil, nil
+	}
+	d, err := api.DateFromString(since)
+	if err != nil {
+		return nil, fmt.Errorf("invalid since date %q: %w", since, err)
+	}
+	return &transaction.Filter{Since: &d}, nil
+}
+
+// SinceDate returns the date remote transactions are fetched from: the
+// earliest statement date minus sinceMargin, or "" for an empty statement.
+func SinceDate(localTxs []*models.Transaction) (string, error) {
+	var earliest time.Time
+	for _, tx := range localTxs {
+		d, err := tx.APIDate()
+		if err != nil {
+			return "", err
+		}
+		if earliest.IsZero() || d.Before(earliest) {
+			earliest = d.Time
+		}
+	}
+	if earliest.IsZero() {
+		return "", nil
+	}
+	return earliest.Add(-sinceMargin).Format("2006-01-02"), nil
+}
 
-    return nil
+// cardsLabel describes the cards a statement is restricted to.
+func cardsLabel(f models.Filter) string {
+	switch {
+	case len(f.Cards) > 0:
+		return strings.Join(f.Cards, ", ")
+	case len(f.ExcludeCards) > 0:
+		return "all but " + strings.Join(f.ExcludeCards, ", ")
+	default:
+		return ""
+	}
 }
@@ -0,0 +1,199 @@
+package executors
+
+// Saved plans, Terraform style: `ynabu plan --out plan.bin` writes the exact
+// set of changes computed for every statement together with a fingerprint of
+// the remote account they were computed against, and `ynabu apply plan.bin`
+// executes exactly those changes – or refuses when the account changed in
+// between.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// planFileVersion is bumped whenever the on-disk format changes in a way
+// older binaries cannot read.
+const planFileVersion = 1
+
+// ErrStalePlan is returned when applying a saved plan whose remote account
+// has changed since the plan was computed.
+var ErrStalePlan = errors.New("saved plan is stale: remote transactions changed since it was created")
+
+// Action is the kind of change a plan step performs on a remote transaction.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Change is a single remote side effect. Creates and updates carry the full
+// payload; updates and deletes carry the YNAB transaction ID they target.
+// Deletes may carry the current payload too, for display only.
+type Change struct {
+	Action        Action                          `json:"action"`
+	LocalID       string                          `json:"local_id,omitempty"`
+	Line          int                             `json:"line,omitempty"`
+	TransactionID string                          `json:"transaction_id,omitempty"`
+	Payload       *transaction.PayloadTransaction `json:"payload,omitempty"`
+}
+
+// PlanStep holds the changes computed for one statement/account pair.
+type PlanStep struct {
+	File        string   `json:"file"`
+	Profile     string   `json:"profile,omitempty"`
+	BudgetID    string   `json:"budget_id"`
+	AccountID   string   `json:"account_id"`
+	Fingerprint string   `json:"fingerprint"`
+	Since       string   `json:"since,omitempty"`
+	Changes     []Change `json:"changes"`
+}
+
+// PlanFile is the serialised form of a saved plan.
+type PlanFile struct {
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Steps     []*PlanStep `json:"steps"`
+}
+
+// Step converts the report into a plan step creating every missing
+// transaction.
+func (r *Report) Step() (*PlanStep, error) {
+	payloads, err := r.Payloads(r.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, len(payloads))
+	for i := range payloads {
+		changes[i] = Change{
+			Action:  ActionCreate,
+			LocalID: r.toSync[i].ID(),
+			Line:    r.toSync[i].LineNumber(),
+			Payload: &payloads[i],
+		}
+	}
+
+	return &PlanStep{
+		File:        r.File,
+		Profile:     r.Profile,
+		BudgetID:    r.BudgetID,
+		AccountID:   r.AccountID,
+		Fingerprint: r.Fingerprint,
+		Since:       r.Since,
+		Changes:     changes,
+	}, nil
+}
+
+// Count returns how many changes of the given action the step holds.
+func (s *PlanStep) Count(action Action) int {
+	n := 0
+	for _, c := range s.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Without returns a copy of the step without the creates of the given local
+// transactions, for applying only part of a plan. The fingerprint is kept:
+// leaving changes out does not make the step any less stale.
+func (s *PlanStep) Without(localIDs []string) *PlanStep {
+	skip := make(map[string]bool, len(localIDs))
+	for _, id := range localIDs {
+		skip[id] = true
+	}
+	out := *s
+	out.Changes = make([]Change, 0, len(s.Changes))
+	for _, c := range s.Changes {
+		if c.Action == ActionCreate && skip[c.LocalID] {
+			continue
+		}
+		out.Changes = append(out.Changes, c)
+	}
+	return &out
+}
+
+// Requests estimates how many YNAB API calls applying the step takes: one
+// read to check the fingerprint, one per chunk of batchSize creates, one for
+// the updates and one per delete.
+func (s *PlanStep) Requests(batchSize int) int {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	n := 1 + s.Count(ActionDelete)
+	n += (s.Count(ActionCreate) + batchSize - 1) / batchSize
+	if s.Count(ActionUpdate) > 0 {
+		n++
+	}
+	return n
+}
+
+// Fingerprint hashes the parts of the remote transactions that influence
+// reconciliation. Two fetches of an unchanged account yield the same value,
+// regardless of the order YNAB returns them in.
+func Fingerprint(remote []*ynab.Transaction) string {
+	lines := make([]string, 0, len(remote))
+	for _, rt := range remote {
+		payee, memo := "", ""
+		if rt.PayeeName != nil {
+			payee = *rt.PayeeName
+		}
+		if rt.Memo != nil {
+			memo = *rt.Memo
+		}
+		lines = append(lines, fmt.Sprintf("%s|%s|%d|%s|%s|%t",
+			rt.ID, rt.Date.Format("2006-01-02"), rt.Amount, payee, memo, rt.Deleted))
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WritePlanFile saves the steps to path.
+func WritePlanFile(path string, steps []*PlanStep) error {
+	pf := &PlanFile{
+		Version:   planFileVersion,
+		CreatedAt: time.Now().UTC(),
+		Steps:     steps,
+	}
+	data, err := json.MarshalIndent(pf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReadPlanFile loads a plan previously written by WritePlanFile.
+func ReadPlanFile(path string) (*PlanFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pf PlanFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("invalid plan file %s: %w", path, err)
+	}
+	if pf.Version != planFileVersion {
+		return nil, fmt.Errorf("plan file %s has version %d, expected %d", path, pf.Version, planFileVersion)
+	}
+	return &pf, nil
+}
@@ -0,0 +1,66 @@
+package executors
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+func TestPlanFileRoundTrip(t *testing.T) {
+	local, err := models.NewTransaction().SetPayee("PADARIA").SetExtrato().SetDate("17/03/2025").SetValueFromExtrato("-12,50").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := BuildReport([]*models.Transaction{local}, nil, true)
+	report.File, report.BudgetID, report.AccountID = "extrato.txt", "budget", "account"
+	report.Fingerprint = Fingerprint(nil)
+
+	step, err := report.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.bin")
+	if err := WritePlanFile(path, []*PlanStep{step}); err != nil {
+		t.Fatal(err)
+	}
+	pf, err := ReadPlanFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pf.Steps) != 1 || len(pf.Steps[0].Changes) != 1 {
+		t.Fatalf("expected 1 step with 1 change, got %+v", pf.Steps)
+	}
+	got := pf.Steps[0].Changes[0]
+	if got.Action != ActionCreate || got.LocalID != local.ID() {
+		t.Errorf("unexpected change %+v", got)
+	}
+	if d := api.DateFormat(got.Payload.Date); d != "2025-03-17" {
+		t.Errorf("date = %s, want 2025-03-17", d)
+	}
+	if got.Payload.Amount != -12500 || got.Payload.AccountID != "account" {
+		t.Errorf("unexpected payload %+v", got.Payload)
+	}
+}
+
+func TestFingerprintIgnoresOrder(t *testing.T) {
+	memo := "\"abc,extrato\""
+	a := &ynab.Transaction{Transaction: &transaction.Transaction{ID: "a", Amount: 1000, Memo: &memo}}
+	b := &ynab.Transaction{Transaction: &transaction.Transaction{ID: "b", Amount: -2000}}
+
+	if Fingerprint([]*ynab.Transaction{a, b}) != Fingerprint([]*ynab.Transaction{b, a}) {
+		t.Error("fingerprint depends on order")
+	}
+
+	changed := &ynab.Transaction{Transaction: &transaction.Transaction{ID: "b", Amount: -2500}}
+	if Fingerprint([]*ynab.Transaction{a, b}) == Fingerprint([]*ynab.Transaction{a, changed}) {
+		t.Error("fingerprint did not change with the amount")
+	}
+}
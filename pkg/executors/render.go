@@ -0,0 +1,236 @@
+package executors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Format selects how Render prints reports.
+type Format string
+
+const (
+	FormatTable    Format = "table"
+	FormatJSON     Format = "json"
+	FormatMarkdown Format = "markdown"
+)
+
+// ParseFormat validates a user supplied output format. An empty string
+// selects the default table view.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return FormatTable, nil
+	case FormatTable, FormatJSON, FormatMarkdown:
+		return f, nil
+	case "md":
+		return FormatMarkdown, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (expected table, json or markdown)", s)
+	}
+}
+
+// Summary holds the counters of one or more reports.
+type Summary struct {
+	Total  int `json:"total"`
+	InSync int `json:"in_sync"`
+	ToAdd  int `json:"to_add"`
+}
+
+// EntryView is the machine-readable form of an Entry.
+type EntryView struct {
+	Status      string  `json:"status"`
+	ID          string  `json:"id"`
+	Date        string  `json:"date"`
+	Payee       string  `json:"payee"`
+	Memo        string  `json:"memo"`
+	Amount      float64 `json:"amount"`
+	Line        int     `json:"line,omitempty"`
+	RemoteID    string  `json:"remote_id,omitempty"`
+	MatchMethod string  `json:"match_method,omitempty"`
+}
+
+// ReportView is the machine-readable form of a Report, shared by the CLI JSON
+// output and the HTTP server.
+type ReportView struct {
+	File         string      `json:"file"`
+	Files        []string    `json:"files,omitempty"`
+	BudgetID     string      `json:"budget_id"`
+	BudgetName   string      `json:"budget_name,omitempty"`
+	BudgetSource string      `json:"budget_source,omitempty"`
+	AccountID    string      `json:"account_id"`
+	Cards        string      `json:"cards,omitempty"`
+	Summary      Summary     `json:"summary"`
+	Entries      []EntryView `json:"entries"`
+}
+
+// PlanView wraps the reports of a whole run with the overall counters.
+type PlanView struct {
+	Reports []ReportView `json:"reports"`
+	Summary Summary      `json:"summary"`
+}
+
+// Summary returns the counters of the report.
+func (r *Report) Summary() Summary {
+	return Summary{Total: len(r.Items), InSync: r.InSyncCount(), ToAdd: r.MissingCount()}
+}
+
+// View converts the report into its machine-readable form.
+func (r *Report) View() ReportView {
+	entries := make([]EntryView, 0, len(r.Items))
+	for _, m := range r.Items {
+		ev := EntryView{
+			Status:      m.Status.String(),
+			ID:          m.Local.ID(),
+			Date:        m.Local.Date(),
+			Payee:       m.Local.Payee(),
+			Memo:        m.Local.Memo(),
+			Amount:      m.Local.Amount(),
+			Line:        m.Local.LineNumber(),
+			MatchMethod: string(m.Method),
+		}
+		if m.Remote != nil {
+			ev.RemoteID = m.Remote.ID
+		}
+		entries = append(entries, ev)
+	}
+	return ReportView{
+		File:         r.File,
+		Files:        r.matchedFiles(),
+		BudgetID:     r.BudgetID,
+		BudgetName:   r.BudgetName,
+		BudgetSource: r.BudgetSource,
+		AccountID:    r.AccountID,
+		Cards:        r.Cards,
+		Summary:      r.Summary(),
+		Entries:      entries,
+	}
+}
+
+// BudgetLabel describes the budget the report was computed against: its name
+// and ID when the name is known, and where it came from.
+func (r *Report) BudgetLabel() string {
+	label := r.BudgetID
+	if r.BudgetName != "" {
+		label = fmt.Sprintf("%s (%s)", r.BudgetName, r.BudgetID)
+	}
+	if r.BudgetSource != "" {
+		label += ", from " + r.BudgetSource
+	}
+	return label
+}
+
+// matchedFiles returns the files a glob or directory statement expanded to,
+// or nil when File named a single file.
+func (r *Report) matchedFiles() []string {
+	if len(r.Files) == 1 && r.Files[0] == r.File {
+		return nil
+	}
+	return r.Files
+}
+
+// NewPlanView converts a set of reports and totals their counters.
+func NewPlanView(reports []*Report) PlanView {
+	pv := PlanView{Reports: make([]ReportView, 0, len(reports))}
+	for _, r := range reports {
+		v := r.View()
+		pv.Summary.Total += v.Summary.Total
+		pv.Summary.InSync += v.Summary.InSync
+		pv.Summary.ToAdd += v.Summary.ToAdd
+		pv.Reports = append(pv.Reports, v)
+	}
+	return pv
+}
+
+// Render writes the reports to w in the requested format.
+func Render(w io.Writer, format Format, reports []*Report) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(NewPlanView(reports))
+	case FormatMarkdown:
+		return renderMarkdown(w, reports)
+	case FormatTable, "":
+		return renderTable(w, reports)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// renderTable prints the colored, terminal oriented preview.
+func renderTable(w io.Writer, reports []*Report) error {
+	syncedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8")) // gray
+	addedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10")) // green
+
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s: budget %s, account %s\n\n", report.File, report.BudgetLabel(), report.AccountID)
+		if files := report.matchedFiles(); len(files) > 0 {
+			fmt.Fprintf(w, "%s matched:\n", report.File)
+			for _, f := range files {
+				fmt.Fprintf(w, "  %s\n", f)
+			}
+			fmt.Fprintln(w)
+		}
+		if report.Cards != "" {
+			fmt.Fprintf(w, "%s: cards %s -> account %s\n\n", report.File, report.Cards, report.AccountID)
+		}
+		for _, m := range report.Items {
+			if m.Status == Synced {
+				line := fmt.Sprintf("%s | %-30s | %s | %s | R$ %.2f", m.Local.Date(), m.Local.Payee(), m.Local.ID(), m.Remote.CustomID(), m.Local.Amount())
+				fmt.Fprintln(w, syncedStyle.Render("= "+line))
+				continue // nothing to add
+			}
+
+			line := fmt.Sprintf("%s | %-30s | %s | %s | R$ %.2f", m.Local.Date(), m.Local.Payee(), m.Local.ID(), "xxxxxxxxxxxxxxxx", m.Local.Amount())
+			fmt.Fprintln(w, addedStyle.Render("+ "+line))
+		}
+
+		if report.MissingCount() == 0 {
+			fmt.Fprintf(w, "\nPlan: All %d transaction(s) are in sync\n", report.InSyncCount())
+		} else {
+			fmt.Fprintf(w, "\nPlan: %d transaction(s) will be added, %d already in sync\n", report.MissingCount(), report.InSyncCount())
+		}
+	}
+	return nil
+}
+
+// renderMarkdown prints one table per report, suitable for PR comments and
+// notes.
+func renderMarkdown(w io.Writer, reports []*Report) error {
+	for _, report := range reports {
+		s := report.Summary()
+		fmt.Fprintf(w, "### %s\n\n", mdEscape(report.File))
+		if files := report.matchedFiles(); len(files) > 0 {
+			fmt.Fprintf(w, "Files: %s\n\n", mdEscape(strings.Join(files, ", ")))
+		}
+		if report.Cards != "" {
+			fmt.Fprintf(w, "Cards: %s\n\n", mdEscape(report.Cards))
+		}
+		fmt.Fprintf(w, "Budget %s, account `%s`: **%d to add**, %d in sync.\n\n", mdEscape(report.BudgetLabel()), report.AccountID, s.ToAdd, s.InSync)
+		fmt.Fprintln(w, "| | Date | Payee | Amount | ID | Remote ID |")
+		fmt.Fprintln(w, "|---|---|---|---:|---|---|")
+		for _, m := range report.Items {
+			mark, remoteID := "+", ""
+			if m.Status == Synced {
+				mark = "="
+				remoteID = m.Remote.ID
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %.2f | `%s` | %s |\n", mark, m.Local.Date(), mdEscape(m.Local.Payee()), m.Local.Amount(), m.Local.ID(), remoteID)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// mdReplacer escapes what would end a table cell or start a code span or
+// emphasis; backslashes first, so an escaped pipe stays escaped.
+var mdReplacer = strings.NewReplacer(`\`, `\\`, "|", `\|`, "`", "\\`", "*", `\*`, "_", `\_`, "\n", " ", "\r", " ")
+
+// mdEscape keeps payees from breaking the markdown table layout.
+func mdEscape(s string) string {
+	return mdReplacer.Replace(s)
+}
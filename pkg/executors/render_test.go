@@ -0,0 +1,78 @@
+package executors
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+func TestRenderJSON(t *testing.T) {
+	synced, _ := models.NewTransaction().SetPayee("PADARIA").SetExtrato().SetDate("17/03/2025").SetValueFromExtrato("-12,50").Build()
+	missing, _ := models.NewTransaction().SetPayee("MERCADO").SetExtrato().SetDate("18/03/2025").SetValueFromExtrato("-80,00").Build()
+
+	memo := synced.Memo()
+	remote := ynab.NewTransaction(&transaction.Transaction{ID: "remote-1", Memo: &memo})
+
+	report := BuildReport([]*models.Transaction{synced, missing}, []*ynab.Transaction{remote}, true)
+
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatJSON, []*Report{report}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got PlanView
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, buf.String())
+	}
+	if got.Summary != (Summary{Total: 2, InSync: 1, ToAdd: 1}) {
+		t.Errorf("summary = %+v", got.Summary)
+	}
+	entries := got.Reports[0].Entries
+	if entries[0].Status != "synced" || entries[0].RemoteID != "remote-1" || entries[0].MatchMethod != string(MatchCustomID) {
+		t.Errorf("unexpected synced entry %+v", entries[0])
+	}
+	if entries[1].Status != "to_add" || entries[1].RemoteID != "" || entries[1].Payee != "MERCADO" {
+		t.Errorf("unexpected missing entry %+v", entries[1])
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	synced, _ := models.NewTransaction().SetPayee("PADARIA | CAFE").SetExtrato().SetDate("17/03/2025").SetValueFromExtrato("-12,50").Build()
+	missing, _ := models.NewTransaction().SetPayee("LOJA `X` \\|").SetExtrato().SetDate("18/03/2025").SetValueFromExtrato("-80,00").Build()
+
+	memo := synced.Memo()
+	remote := ynab.NewTransaction(&transaction.Transaction{ID: "remote-1", Memo: &memo})
+
+	report := BuildReport([]*models.Transaction{synced, missing}, []*ynab.Transaction{remote}, true)
+	report.File, report.AccountID = "extrato|marco.txt", "account-1"
+
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatMarkdown, []*Report{report}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"### extrato\\|marco.txt\n",
+		"| = | 2025/03/17 | PADARIA \\| CAFE | -12.50 | `" + synced.ID() + "` | remote-1 |\n",
+		"| + | 2025/03/18 | LOJA \\`X\\` \\\\\\| | -80.00 | `" + missing.ID() + "` |  |\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	// every row keeps the 7 unescaped pipes of its 6 cells
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "| ") || strings.HasPrefix(line, "|---") {
+			continue
+		}
+		if n := strings.Count(line, "|") - strings.Count(line, "\\|"); n != 7 {
+			t.Errorf("row has %d cell separators: %s", n, line)
+		}
+	}
+}
@@ -51,6 +51,27 @@ const (
 	ToAdd
 )
 
+// String returns the lower-case name used in machine-readable output.
+func (s Status) String() string {
+	switch s {
+	case Synced:
+		return "synced"
+	case ToAdd:
+		return "to_add"
+	default:
+		return fmt.Sprintf("status(%d)", int(s))
+	}
+}
+
+// MatchMethod records how a local transaction was matched to a remote one.
+type MatchMethod string
+
+const (
+	MatchNone      MatchMethod = ""
+	MatchCustomID  MatchMethod = "custom_id"
+	MatchHeuristic MatchMethod = "amount_payee_date"
+)
+
 // Entry links a local transaction with its remote counterpart (if any) and
 // records the reconciliation status.
 
@@ -58,6 +79,7 @@ type Entry struct {
 	Local  *models.Transaction
 	Remote *ynab.Transaction // nil when status == ToAdd
 	Status Status
+	Method MatchMethod // MatchNone when status == ToAdd
 }
 
 // RemoteCustomID is a helper that returns the remote CustomID when present.
@@ -71,7 +93,33 @@ func (e Entry) RemoteCustomID() string {
 // Report is the main reconciled data-structure returned by Build.
 
 type Report struct {
-	Items  []Entry
+	Items []Entry
+
+	// Where the report was computed. Filled in by the Executor; BuildReport
+	// leaves them empty.
+	File      string
+	Files     []string // what File matched, newest first
+	BudgetID  string
+	AccountID string
+	// BudgetName is the name of BudgetID when it could be listed, and
+	// BudgetSource where the budget came from (see BudgetRef).
+	BudgetName   string
+	BudgetSource string
+	// Profile is the configuration profile the report was computed with,
+	// empty for the top-level settings.
+	Profile string
+	// Cards describes which cards of a fatura routed with a cards mapping
+	// the report covers, empty otherwise.
+	Cards       string
+	Fingerprint string
+	// Cleared and Approved are the state Payloads creates transactions in;
+	// cleared and approved when unset.
+	Cleared  transaction.ClearingStatus
+	Approved *bool
+	// Since is the earliest remote date fetched (YYYY-MM-DD); empty when the
+	// whole account history was read.
+	Since string
+
 	toSync []*models.Transaction
 }
 
@@ -90,11 +138,11 @@ func BuildReport(local []*models.Transaction, remote []*ynab.Transaction, useCus
 		}
 		for _, lt := range local {
 			found := idx[lt.ID()]
-			status := ToAdd
+			status, method := ToAdd, MatchNone
 			if found != nil {
-				status = Synced
+				status, method = Synced, MatchCustomID
 			}
-			items = append(items, Entry{Local: lt, Remote: found, Status: status})
+			items = append(items, Entry{Local: lt, Remote: found, Status: status, Method: method})
 			if status == ToAdd {
 				toSync = append(toSync, lt)
 			}
@@ -121,11 +169,11 @@ func BuildReport(local []*models.Transaction, remote []*ynab.Transaction, useCus
 				// Different transaction despite the same key → treat as missing.
 				found = nil
 			}
-			status := ToAdd
+			status, method := ToAdd, MatchNone
 			if found != nil {
-				status = Synced
+				status, method = Synced, MatchHeuristic
 			}
-			items = append(items, Entry{Local: lt, Remote: found, Status: status})
+			items = append(items, Entry{Local: lt, Remote: found, Status: status, Method: method})
 			if status == ToAdd {
 				toSync = append(toSync, lt)
 			}
@@ -173,6 +221,14 @@ func (r *Report) TransactionsToSync() []*models.Transaction {
 func (r *Report) Payloads(accountID string) ([]transaction.PayloadTransaction, error) {
 	out := make([]transaction.PayloadTransaction, 0, len(r.toSync))
 
+	cleared, approved := transaction.ClearingStatusCleared, true
+	if r.Cleared != "" {
+		cleared = r.Cleared
+	}
+	if r.Approved != nil {
+		approved = *r.Approved
+	}
+
 	// Track seen transaction IDs by date+ID to handle duplicates
 	seenIDs := make(map[string]int) // "date+id" -> count
 
@@ -200,8 +256,8 @@ func (r *Report) Payloads(accountID string) ([]transaction.PayloadTransaction, e
 			AccountID: accountID,
 			Date:      dateVal,
 			Amount:    lt.AmountMilliunits(),
-			Cleared:   transaction.ClearingStatusCleared,
-			Approved:  true,
+			Cleared:   cleared,
+			Approved:  approved,
 			PayeeName: payeeName,
 			Memo:      memo,
 		})
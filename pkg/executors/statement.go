@@ -0,0 +1,61 @@
+package executors
+
+import (
+	"fmt"
+
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/rules"
+)
+
+// StatementError is returned for a statement that is wrong before YNAB is
+// asked anything: files that cannot be parsed, when Parse is set, or invalid
+// options. Retrying does not help, the statement has to be fixed.
+type StatementError struct {
+	Err   error
+	Parse bool
+}
+
+func (e *StatementError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// LoadTransactions parses the files of a statement, as returned by its
+// Files, and applies its options: first the filter, then the rules file.
+// convert, plan and apply all read statements through it so they see the
+// same transactions.
+func LoadTransactions(p models.Parser, statement *models.Statement, files []string) ([]*models.Transaction, error) {
+	txs, err := statement.TransactionsFrom(p, files)
+	if err != nil {
+		return nil, &StatementError{Err: err, Parse: true}
+	}
+
+	txs, err = statement.Filter.Apply(txs)
+	if err != nil {
+		return nil, &StatementError{Err: fmt.Errorf("statement %s: %w", statement.Name(), err)}
+	}
+
+	if statement.Rules != "" {
+		set, err := rules.Load(statement.Rules)
+		if err != nil {
+			return nil, &StatementError{Err: err}
+		}
+		txs = set.Apply(txs)
+	}
+	return txs, nil
+}
+
+// clearingStatus validates the cleared option of a statement.
+func clearingStatus(statement *models.Statement) (transaction.ClearingStatus, error) {
+	switch s := transaction.ClearingStatus(statement.Cleared); s {
+	case "", transaction.ClearingStatusCleared, transaction.ClearingStatusUncleared, transaction.ClearingStatusReconciled:
+		return s, nil
+	default:
+		return "", &StatementError{Err: fmt.Errorf("statement %s: invalid cleared %q (want cleared, uncleared or reconciled)", statement.Name(), statement.Cleared)}
+	}
+}
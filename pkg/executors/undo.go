@@ -0,0 +1,119 @@
+package executors
+
+import (
+	"fmt"
+
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/journal"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// PlanUndo computes the steps that revert every change recorded in run:
+// created transactions are deleted, updated ones are restored to their
+// previous state and deleted ones are created again, without their
+// import_id. Changes whose target no longer exists remotely are skipped.
+// The steps carry a fingerprint of the accounts, so applying them with
+// ApplyStep refuses if anything changes in between. Only records made with
+// the executor's profile are considered; see journal.Record.Profile.
+func (e *Executor) PlanUndo(run *journal.Run) ([]*PlanStep, error) {
+	type account struct{ budgetID, accountID string }
+
+	var order []account
+	byAccount := make(map[account][]journal.Record)
+	for _, rec := range run.Records {
+		if rec.Profile != e.config.Profile {
+			continue
+		}
+		k := account{rec.BudgetID, rec.AccountID}
+		if _, ok := byAccount[k]; !ok {
+			order = append(order, k)
+		}
+		byAccount[k] = append(byAccount[k], rec)
+	}
+
+	steps := make([]*PlanStep, 0, len(order))
+	for _, k := range order {
+		remoteTxs, err := e.ynab.GetTransactionsByAccount(k.budgetID, k.accountID, nil)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[string]*ynab.Transaction, len(remoteTxs))
+		for _, rt := range remoteTxs {
+			if !rt.Deleted {
+				current[rt.ID] = rt
+			}
+		}
+
+		step := &PlanStep{
+			File:        "undo " + run.ID,
+			Profile:     e.config.Profile,
+			BudgetID:    k.budgetID,
+			AccountID:   k.accountID,
+			Fingerprint: Fingerprint(remoteTxs),
+		}
+
+		// Revert newest first so repeated changes unwind in order.
+		records := byAccount[k]
+		for i := len(records) - 1; i >= 0; i-- {
+			rec := records[i]
+			rt, exists := current[rec.TransactionID]
+
+			switch Action(rec.Action) {
+			case ActionCreate:
+				if !exists {
+					e.logger.Warn("created transaction no longer exists, skipping", "transaction_id", rec.TransactionID)
+					continue
+				}
+				step.Changes = append(step.Changes, Change{
+					Action:        ActionDelete,
+					TransactionID: rec.TransactionID,
+					Payload:       payloadFrom(rt.Transaction),
+				})
+			case ActionUpdate:
+				if !exists || rec.Before == nil {
+					e.logger.Warn("updated transaction cannot be restored, skipping", "transaction_id", rec.TransactionID)
+					continue
+				}
+				step.Changes = append(step.Changes, Change{
+					Action:        ActionUpdate,
+					TransactionID: rec.TransactionID,
+					Payload:       payloadFrom(rec.Before),
+				})
+			case ActionDelete:
+				if rec.Before == nil {
+					e.logger.Warn("deleted transaction has no recorded state, skipping", "transaction_id", rec.TransactionID)
+					continue
+				}
+				// YNAB skips creates whose import_id an account already
+				// used, so the copy is created as a manual transaction.
+				p := payloadFrom(rec.Before)
+				p.ID, p.ImportID = "", nil
+				step.Changes = append(step.Changes, Change{Action: ActionCreate, Payload: p})
+			default:
+				return nil, fmt.Errorf("unknown journal action %q in run %s", rec.Action, run.ID)
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// payloadFrom rebuilds the payload that would recreate tx as it is.
+func payloadFrom(tx *transaction.Transaction) *transaction.PayloadTransaction {
+	return &transaction.PayloadTransaction{
+		ID:         tx.ID,
+		AccountID:  tx.AccountID,
+		Date:       tx.Date,
+		Amount:     tx.Amount,
+		Cleared:    tx.Cleared,
+		Approved:   tx.Approved,
+		PayeeID:    tx.PayeeID,
+		PayeeName:  tx.PayeeName,
+		CategoryID: tx.CategoryID,
+		Memo:       tx.Memo,
+		FlagColor:  tx.FlagColor,
+		ImportID:   tx.ImportID,
+	}
+}
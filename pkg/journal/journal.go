@@ -0,0 +1,193 @@
+// Package journal records the remote side effects of every apply so they can
+// be listed (`ynabu history`) and reverted (`ynabu undo`).
+//
+// Each run is stored as one JSON file under the journal directory, named
+// after the run ID. IDs start with a UTC timestamp so lexical order is
+// chronological order.
+package journal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+)
+
+// ErrNotFound is returned when a run does not exist.
+var ErrNotFound = errors.New("run not found")
+
+// Kind tells what produced a run.
+type Kind string
+
+const (
+	KindApply Kind = "apply"
+	KindUndo  Kind = "undo"
+)
+
+// Record is a single change made to a remote transaction.
+type Record struct {
+	// Profile is the configuration profile whose token made the change,
+	// empty for the top-level settings.
+	Profile       string `json:"profile,omitempty"`
+	BudgetID      string `json:"budget_id"`
+	AccountID     string `json:"account_id"`
+	Action        string `json:"action"` // create, update or delete
+	TransactionID string `json:"transaction_id"`
+	// Before is the remote transaction as it was before the change. It is
+	// nil for creates.
+	Before *transaction.Transaction `json:"before,omitempty"`
+}
+
+// Run groups the records of one `ynabu apply` (or undo) invocation.
+type Run struct {
+	ID         string    `json:"id"`
+	Kind       Kind      `json:"kind"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	// Undoes is set on undo runs to the run they reverted; UndoneBy is set on
+	// the reverted run.
+	Undoes   string   `json:"undoes,omitempty"`
+	UndoneBy string   `json:"undone_by,omitempty"`
+	Records  []Record `json:"records"`
+
+	mu sync.Mutex
+}
+
+// Add appends a record. It is safe for concurrent use.
+func (r *Run) Add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Records = append(r.Records, rec)
+}
+
+// Count returns how many records of the given action the run holds.
+func (r *Run) Count(action string) int {
+	n := 0
+	for _, rec := range r.Records {
+		if rec.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Journal stores runs in a directory.
+type Journal struct {
+	dir string
+}
+
+// Open returns a journal rooted at dir, creating it when needed.
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create journal dir: %w", err)
+	}
+	return &Journal{dir: dir}, nil
+}
+
+// Begin starts a new, not yet saved, run.
+func (j *Journal) Begin(kind Kind) *Run {
+	now := time.Now().UTC()
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return &Run{
+		ID:        now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Kind:      kind,
+		StartedAt: now,
+	}
+}
+
+// Finish stamps the run with its end time and outcome and saves it. Runs
+// without records are not worth keeping and are skipped.
+func (j *Journal) Finish(run *Run, runErr error) error {
+	run.FinishedAt = time.Now().UTC()
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+	if len(run.Records) == 0 {
+		return nil
+	}
+	return j.Save(run)
+}
+
+// Save writes the run to disk, replacing any previous version.
+func (j *Journal) Save(run *Run) error {
+	run.mu.Lock()
+	data, err := json.MarshalIndent(run, "", "  ")
+	run.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated run.
+	tmp := j.path(run.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path(run.ID))
+}
+
+// Load reads a run by ID.
+func (j *Journal) Load(id string) (*Run, error) {
+	data, err := os.ReadFile(j.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("invalid journal entry %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+// List returns every run, newest first.
+func (j *Journal) List() ([]*Run, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*Run
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		run, err := j.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(a, b int) bool { return runs[a].ID > runs[b].ID })
+	return runs, nil
+}
+
+// LastUndoable returns the newest apply run that has not been undone yet.
+func (j *Journal) LastUndoable() (*Run, error) {
+	runs, err := j.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if run.Kind == KindApply && run.UndoneBy == "" {
+			return run, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no apply left to undo", ErrNotFound)
+}
+
+func (j *Journal) path(id string) string {
+	return filepath.Join(j.dir, filepath.Base(id)+".json")
+}
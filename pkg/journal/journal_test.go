@@ -0,0 +1,53 @@
+package journal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJournalLastUndoable(t *testing.T) {
+	j, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.LastUndoable(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on empty journal, got %v", err)
+	}
+
+	first := j.Begin(KindApply)
+	first.ID = "20250101-000000-aaaaaa"
+	first.Add(Record{BudgetID: "b", AccountID: "a", Action: "create", TransactionID: "t1"})
+	if err := j.Finish(first, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	second := j.Begin(KindApply)
+	second.ID = "20250102-000000-bbbbbb"
+	second.Add(Record{BudgetID: "b", AccountID: "a", Action: "create", TransactionID: "t2"})
+	second.UndoneBy = "20250103-000000-cccccc"
+	if err := j.Finish(second, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Runs without records are not persisted.
+	if err := j.Finish(j.Begin(KindApply), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := j.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != second.ID {
+		t.Fatalf("expected 2 runs newest first, got %d", len(runs))
+	}
+
+	last, err := j.LastUndoable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.ID != first.ID || last.Records[0].TransactionID != "t1" {
+		t.Errorf("LastUndoable = %s, want %s", last.ID, first.ID)
+	}
+}
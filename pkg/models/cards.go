@@ -0,0 +1,74 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// RouteCards splits every statement with a cards mapping into one statement
+// per destination account, each keeping only the transactions of its cards,
+// plus one for the statement's own account (if any) with the remaining
+// cards. Statements without a mapping are returned unchanged. The
+// statements must be valid, so no transaction goes to two accounts.
+func RouteCards(statements []Statement) []Statement {
+	out := make([]Statement, 0, len(statements))
+	for _, st := range statements {
+		if len(st.CardAccounts) == 0 {
+			out = append(out, st)
+			continue
+		}
+
+		keys := make([]string, 0, len(st.CardAccounts))
+		for card := range st.CardAccounts {
+			keys = append(keys, card)
+		}
+		sort.Strings(keys)
+
+		// Group cards going to the same account, in a stable order.
+		var accounts []string
+		byAccount := make(map[string][]string)
+		for _, card := range keys {
+			account := st.CardAccounts[card]
+			if _, ok := byAccount[account]; !ok {
+				accounts = append(accounts, account)
+			}
+			byAccount[account] = append(byAccount[account], card)
+		}
+
+		if st.AccountRef() != "" {
+			rest := st
+			rest.CardAccounts = nil
+			rest.Filter.ExcludeCards = append(append([]string(nil), st.Filter.ExcludeCards...), keys...)
+			out = append(out, rest)
+		}
+		for _, account := range accounts {
+			routed := st
+			routed.CardAccounts = nil
+			routed.AccountID, routed.Account = "", account
+			routed.Filter.Cards = byAccount[account]
+			out = append(out, routed)
+		}
+	}
+	return out
+}
+
+// cardsOverlap reports whether a transaction can match both cards, as
+// cardMatches matches them: final digits overlap when one ends the other,
+// holders when they are equal, and any holder can have any digits.
+func cardsOverlap(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if isDigits(a) != isDigits(b) {
+		return true
+	}
+	if isDigits(a) {
+		return strings.HasSuffix(a, b) || strings.HasSuffix(b, a)
+	}
+	return strings.EqualFold(a, b)
+}
+
+func isDigits(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestRouteCards(t *testing.T) {
+	statements := RouteCards([]Statement{
+		{FilePath: "extrato.txt", AccountID: "checking"},
+		{
+			FilePath: "Fatura.xls",
+			Account:  "Cartão Yuri",
+			CardAccounts: map[string]string{
+				"adicional": "Cartão Partner",
+				"9876":      "Cartão Partner",
+				"5555":      "Cartão Viagem",
+			},
+		},
+	})
+
+	if len(statements) != 4 {
+		t.Fatalf("expected 4 statements, got %d: %+v", len(statements), statements)
+	}
+	if statements[0].AccountID != "checking" || len(statements[0].Filter.Cards) != 0 {
+		t.Errorf("statements without cards must be left alone: %+v", statements[0])
+	}
+
+	fatura := func(holder, number string) *Transaction {
+		tx, err := NewTransaction().SetPayee("POSTO").SetFatura(holder, number).SetDate("17/03/2025").SetValueFromFatura("100,00").Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	txs := []*Transaction{fatura("titular", "1234"), fatura("adicional", "9876"), fatura("titular", "5555")}
+
+	want := map[string]int{"Cartão Yuri": 1, "Cartão Partner": 1, "Cartão Viagem": 1}
+	for _, st := range statements[1:] {
+		got, err := st.Filter.Apply(txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != want[st.AccountRef()] {
+			t.Errorf("%s: got %d transactions, want %d", st.AccountRef(), len(got), want[st.AccountRef()])
+		}
+		if st.AccountRef() == "Cartão Yuri" && got[0].CardNumber() != "1234" {
+			t.Errorf("the statement's own account must keep the unrouted card, got %s", got[0].CardNumber())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Selection modes for statements whose file matches several files.
+const (
+	SelectAll    = "all"    // every match, overlapping days deduplicated
+	SelectNewest = "newest" // only the most recently modified match
+)
+
+// ExpandFiles resolves a statement path into the files it refers to, newest
+// first. The path may start with ~/, name a directory (every regular file
+// in it, hidden ones excluded) or be a glob pattern such as
+// ~/Downloads/Extrato*.xls.
+func ExpandFiles(path string) ([]string, error) {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	var candidates []string
+	switch info, err := os.Stat(path); {
+	case err == nil && info.IsDir():
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			candidates = append(candidates, filepath.Join(path, e.Name()))
+		}
+	case err == nil:
+		return []string{path}, nil
+	case strings.ContainsAny(path, "*?["):
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", path, err)
+		}
+		candidates = matches
+	default:
+		return nil, fmt.Errorf("statement file %s: %w", path, err)
+	}
+
+	type file struct {
+		path    string
+		modTime int64
+	}
+	var files []file
+	for _, c := range candidates {
+		if strings.HasPrefix(filepath.Base(c), ".") {
+			continue
+		}
+		info, err := os.Stat(c)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, file{c, info.ModTime().UnixNano()})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no statement files match %s", path)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].modTime != files[j].modTime {
+			return files[i].modTime > files[j].modTime
+		}
+		return files[i].path > files[j].path
+	})
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.path
+	}
+	return out, nil
+}
+
+// mergeByDay combines the transactions of files that may cover overlapping
+// periods, given newest first. Every day is taken whole from the newest file
+// that has it, so a transaction downloaded twice is counted once while days
+// only an older file covers are kept.
+func mergeByDay(perFile [][]*Transaction) []*Transaction {
+	owner := make(map[string]int)
+	for i, txs := range perFile {
+		for _, tx := range txs {
+			if _, ok := owner[tx.Date()]; !ok {
+				owner[tx.Date()] = i
+			}
+		}
+	}
+
+	var out []*Transaction
+	for i, txs := range perFile {
+		for _, tx := range txs {
+			if owner[tx.Date()] == i {
+				out = append(out, tx)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineParser parses "dd/mm/yyyy;payee;amount" lines.
+type lineParser struct{}
+
+func (lineParser) ProcessBytes(data []byte, _ string) ([]*Transaction, error) {
+	var out []*Transaction
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		f := strings.Split(line, ";")
+		tx, err := NewTransaction().SetDate(f[0]).SetPayee(f[1]).SetValueFromExtrato(f[2]).SetExtrato().SetLineNumber(i + 1).Build()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tx)
+	}
+	return out, nil
+}
+
+func writeStatement(t *testing.T, dir, name, content string, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(-age)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatementGlobMergesOverlappingDays(t *testing.T) {
+	dir := t.TempDir()
+	// March download, then a newer one overlapping its last day.
+	writeStatement(t, dir, "Extrato-1.txt", "17/03/2025;PADARIA;-10,00\n18/03/2025;MERCADO;-50,00", 2*time.Hour)
+	writeStatement(t, dir, "Extrato-2.txt", "18/03/2025;MERCADO;-50,00\n18/03/2025;FARMACIA;-20,00\n19/03/2025;POSTO;-100,00", time.Hour)
+	writeStatement(t, dir, "notes.md", "ignored", 0)
+
+	st := &Statement{FilePath: filepath.Join(dir, "Extrato*.txt")}
+	files, err := st.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "Extrato-2.txt" {
+		t.Fatalf("expected both files, newest first, got %v", files)
+	}
+
+	txs, err := st.Transactions(lineParser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payees []string
+	for _, tx := range txs {
+		payees = append(payees, tx.Payee())
+	}
+	if got := strings.Join(payees, ","); got != "MERCADO,FARMACIA,POSTO,PADARIA" {
+		t.Fatalf("unexpected merge %s", got)
+	}
+
+	st.Select = SelectNewest
+	if txs, _ = st.Transactions(lineParser{}); len(txs) != 3 {
+		t.Fatalf("newest selection: expected 3 transactions, got %d", len(txs))
+	}
+
+	// the files listed are the ones parsed, whatever matches now
+	writeStatement(t, dir, "Extrato-3.txt", "20/03/2025;NOVO;-1,00", 0)
+	if txs, _ = st.TransactionsFrom(lineParser{}, files[1:]); len(txs) != 2 || txs[0].Payee() != "PADARIA" {
+		t.Fatalf("expected only the oldest file to be parsed, got %d transactions", len(txs))
+	}
+}
+
+func TestExpandFilesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeStatement(t, dir, "a.txt", "", time.Hour)
+	writeStatement(t, dir, ".hidden", "", 0)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ExpandFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != "a.txt" {
+		t.Fatalf("unexpected files %v", files)
+	}
+
+	if _, err := ExpandFiles(filepath.Join(dir, "*.xls")); err == nil {
+		t.Fatal("expected an error when nothing matches")
+	}
+}
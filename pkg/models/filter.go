@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Filter selects which parsed transactions of a statement are kept. The zero
+// value keeps everything. Dates are inclusive and accept YYYY/MM/DD or
+// YYYY-MM-DD.
+type Filter struct {
+	Start string      `yaml:"start"`
+	End   string      `yaml:"end"`
+	Min   *float64    `yaml:"min"`
+	Max   *float64    `yaml:"max"`
+	Payee PayeeFilter `yaml:"payee"`
+	// Cards keeps only fatura transactions of the given cards: the final
+	// digits of the number (e.g. "1234") or the holder ("titular",
+	// "adicional"), for faturas where cards belong to different accounts.
+	Cards []string `yaml:"card"`
+	// ExcludeCards drops the transactions of the given cards. It is set by
+	// RouteCards for the transactions no card route claims.
+	ExcludeCards []string `yaml:"-"`
+}
+
+// PayeeFilter matches payees by case-insensitive substring. A transaction is
+// kept when it matches any Include entry (or Include is empty) and no
+// Exclude entry.
+type PayeeFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Func validates the filter and returns it as a predicate.
+func (f Filter) Func() (func(*Transaction) bool, error) {
+	start, err := filterDate(f.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	end, err := filterDate(f.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date: %w", err)
+	}
+
+	return func(t *Transaction) bool {
+		if start != "" && t.Date() < start {
+			return false
+		}
+		if end != "" && t.Date() > end {
+			return false
+		}
+		if f.Min != nil && t.Amount() < *f.Min {
+			return false
+		}
+		if f.Max != nil && t.Amount() > *f.Max {
+			return false
+		}
+
+		payee := strings.ToLower(t.Payee())
+		if len(f.Payee.Include) > 0 && !containsAny(payee, f.Payee.Include) {
+			return false
+		}
+		if containsAny(payee, f.Payee.Exclude) {
+			return false
+		}
+
+		if len(f.Cards) > 0 && !cardMatches(t, f.Cards) {
+			return false
+		}
+		if cardMatches(t, f.ExcludeCards) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// Apply returns the transactions of txs the filter keeps.
+func (f Filter) Apply(txs []*Transaction) ([]*Transaction, error) {
+	keep, err := f.Func()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Transaction, 0, len(txs))
+	for _, t := range txs {
+		if keep(t) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// Merge returns f with every unset field taken from other.
+func (f Filter) Merge(other Filter) Filter {
+	if f.Start == "" {
+		f.Start = other.Start
+	}
+	if f.End == "" {
+		f.End = other.End
+	}
+	if f.Min == nil {
+		f.Min = other.Min
+	}
+	if f.Max == nil {
+		f.Max = other.Max
+	}
+	if len(f.Payee.Include) == 0 {
+		f.Payee.Include = other.Payee.Include
+	}
+	if len(f.Payee.Exclude) == 0 {
+		f.Payee.Exclude = other.Payee.Exclude
+	}
+	if len(f.Cards) == 0 {
+		f.Cards = other.Cards
+	}
+	if len(f.ExcludeCards) == 0 {
+		f.ExcludeCards = other.ExcludeCards
+	}
+	return f
+}
+
+// filterDate normalises a filter date to the YYYY/MM/DD form of
+// Transaction.Date.
+func filterDate(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	s = strings.ReplaceAll(strings.TrimSpace(s), "-", "/")
+	if _, err := time.Parse("2006/01/02", s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// cardMatches reports whether the transaction belongs to one of cards, given
+// as final digits or holder.
+func cardMatches(t *Transaction, cards []string) bool {
+	for _, card := range cards {
+		card = strings.TrimSpace(card)
+		switch {
+		case card == "":
+		case t.CardNumber() != "" && strings.HasSuffix(t.CardNumber(), card):
+			return true
+		case t.CardType() != "" && strings.EqualFold(t.CardType(), card):
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if sub != "" && strings.Contains(s, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
+}
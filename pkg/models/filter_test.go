@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	tx := func(date, payee, value, card string) *Transaction {
+		t.Helper()
+		b := NewTransaction().SetPayee(payee).SetDate(date)
+		if card != "" {
+			b = b.SetFatura("Titular", card).SetValueFromFatura(value)
+		} else {
+			b = b.SetExtrato().SetValueFromExtrato(value)
+		}
+		out, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	txs := []*Transaction{
+		tx("16/03/2025", "PADARIA", "-10,00", ""),
+		tx("17/03/2025", "MERCADO", "-50,00", ""),
+		tx("18/03/2025", "FARMACIA", "-20,00", ""),
+		tx("18/03/2025", "POSTO", "100,00", "XXXX1234"),
+		tx("18/03/2025", "POSTO", "200,00", "XXXX9876"),
+	}
+
+	min := -30.0
+	cases := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"zero value", Filter{}, 5},
+		{"date range", Filter{Start: "2025-03-17", End: "2025/03/17"}, 1},
+		{"min amount", Filter{Min: &min}, 2},
+		{"payee include", Filter{Payee: PayeeFilter{Include: []string{"merc", "farm"}}}, 2},
+		{"payee exclude", Filter{Payee: PayeeFilter{Exclude: []string{"posto"}}}, 3},
+		{"card", Filter{Cards: []string{"1234"}}, 1},
+	}
+	for _, c := range cases {
+		got, err := c.filter.Apply(txs)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(got) != c.want {
+			t.Errorf("%s: got %d transactions, want %d", c.name, len(got), c.want)
+		}
+	}
+
+	if _, err := (Filter{Start: "17/03/2025"}).Apply(txs); err == nil {
+		t.Error("expected an error for a malformed date")
+	}
+}
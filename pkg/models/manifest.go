@@ -1,10 +1,12 @@
 package models
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,8 +16,18 @@ type Parser interface {
 	ProcessBytes(data []byte, filename string) ([]*Transaction, error)
 }
 
-// Manifest represents the structure of the YAML manifest file.
+// FormatParser is a Parser that can be told the format of a file instead of
+// guessing it from the name, for statements with a format override.
+type FormatParser interface {
+	Parser
+	ProcessBytesAs(data []byte, format string) ([]*Transaction, error)
+}
+
+// Manifest represents the structure of the YAML manifest file. BudgetID and
+// Budget are the default budget of statements that name none.
 type Manifest struct {
+	BudgetID   string      `yaml:"budget_id"`
+	Budget     string      `yaml:"budget"`
 	Statements []Statement `yaml:"statements"`
 }
 
@@ -25,57 +37,180 @@ type YNABConfig struct {
 	TokenEnv  string `yaml:"token_env"`
 }
 
-// Statement represents a single statement to be processed.
+// Statement represents a single statement to be processed. The budget and
+// account can be given by ID or by name (Budget/Account); IDs win when both
+// are set. FilePath may be a glob or a directory, see ExpandFiles; Select
+// picks among the matches (SelectAll by default). Statements built in code
+// may have a Source instead of a FilePath.
 type Statement struct {
 	FilePath  string `yaml:"file"`
+	Select    string `yaml:"select"`
 	BudgetID  string `yaml:"budget_id"`
+	Budget    string `yaml:"budget"`
 	AccountID string `yaml:"account_id"`
+	Account   string `yaml:"account"`
+
+	// Format overrides the parser picked from the file name, e.g.
+	// "itau-fatura-xls".
+	Format string `yaml:"format"`
+	// Filter narrows the transactions taken from the files.
+	Filter Filter `yaml:",inline"`
+	// CardAccounts routes fatura transactions to other accounts by card:
+	// final digits or holder ("titular", "adicional") to account name or
+	// ID. Cards not listed stay in the statement's own account, or are
+	// skipped when it has none. See RouteCards.
+	CardAccounts map[string]string `yaml:"cards"`
+	// Rules is a rules file rewriting payees or skipping transactions.
+	Rules string `yaml:"rules"`
+	// Cleared and Approved are the state new transactions are created in,
+	// "cleared" and approved unless set.
+	Cleared  string `yaml:"cleared"`
+	Approved *bool  `yaml:"approved"`
+	// Profile is the configuration profile (token, default budget and
+	// rules) the statement is synced with instead of the selected one.
+	Profile string `yaml:"profile"`
+
+	// DefaultBudget is the manifest-level budget (ID or name), set by Parse
+	// for statements to fall back on.
+	DefaultBudget string `yaml:"-"`
+	// Source is the in-memory content of the statement, read instead of
+	// FilePath when set.
+	Source *Source `yaml:"-"`
 }
 
-// File returns the absolute path to the statement file, expanding ~.
-func (s *Statement) File() (string, error) {
-	if strings.HasPrefix(s.FilePath, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
-		}
-		return filepath.Join(home, s.FilePath[2:]), nil
+// BudgetRef returns the budget ID, or the budget name when no ID is set.
+func (s *Statement) BudgetRef() string {
+	if s.BudgetID != "" {
+		return s.BudgetID
 	}
-	return s.FilePath, nil
+	return s.Budget
 }
 
-// Transactions reads the statement file and uses the provided parser to return transactions.
-func (s *Statement) Transactions(p Parser) ([]*Transaction, error) {
-	filePath, err := s.File()
+// AccountRef returns the account ID, or the account name when no ID is set.
+func (s *Statement) AccountRef() string {
+	if s.AccountID != "" {
+		return s.AccountID
+	}
+	return s.Account
+}
+
+// applyDefaults records the manifest-level budget on every statement.
+func (m *Manifest) applyDefaults() {
+	ref := m.BudgetID
+	if ref == "" {
+		ref = m.Budget
+	}
+	for i := range m.Statements {
+		m.Statements[i].DefaultBudget = ref
+	}
+}
+
+// Files returns the statement files FilePath matches, newest first, after
+// applying Select. A statement with a Source has just that one, by name.
+func (s *Statement) Files() ([]string, error) {
+	if s.Source != nil {
+		return []string{s.Source.Name}, nil
+	}
+	files, err := ExpandFiles(s.FilePath)
 	if err != nil {
 		return nil, err
 	}
+	switch s.Select {
+	case "", SelectAll:
+		return files, nil
+	case SelectNewest:
+		return files[:1], nil
+	default:
+		return nil, fmt.Errorf("statement %s: unknown select %q (want %s or %s)", s.FilePath, s.Select, SelectAll, SelectNewest)
+	}
+}
 
-	fileBytes, err := os.ReadFile(filePath)
+// Transactions reads the statement files and uses the provided parser to
+// return their transactions. When several files match, days covered by more
+// than one file are taken from the newest.
+func (s *Statement) Transactions(p Parser) ([]*Transaction, error) {
+	files, err := s.Files()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read statement file %s: %w", filePath, err)
+		return nil, err
+	}
+	return s.TransactionsFrom(p, files)
+}
+
+// TransactionsFrom is Transactions for the files a call to Files returned,
+// so callers that report them parse exactly those, even when the directory
+// changed since.
+func (s *Statement) TransactionsFrom(p Parser, files []string) ([]*Transaction, error) {
+	if s.Source != nil {
+		return s.parse(p, s.Source.Data, s.Source.Name)
 	}
 
-	transactions, err := p.ProcessBytes(fileBytes, filepath.Base(filePath))
+	perFile := make([][]*Transaction, 0, len(files))
+	for _, filePath := range files {
+		fileBytes, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read statement file %s: %w", filePath, err)
+		}
+
+		transactions, err := s.parse(p, fileBytes, filePath)
+		if err != nil {
+			return nil, err
+		}
+		perFile = append(perFile, transactions)
+	}
+	if len(perFile) == 1 {
+		return perFile[0], nil
+	}
+	return mergeByDay(perFile), nil
+}
+
+// parse parses the content of one statement file with the format override,
+// or the parser the file name picks.
+func (s *Statement) parse(p Parser, data []byte, filePath string) ([]*Transaction, error) {
+	var transactions []*Transaction
+	var err error
+	if s.Format != "" {
+		fp, ok := p.(FormatParser)
+		if !ok {
+			return nil, fmt.Errorf("statement %s: parser does not support format overrides", s.Name())
+		}
+		transactions, err = fp.ProcessBytesAs(data, s.Format)
+	} else {
+		transactions, err = p.ProcessBytes(data, filepath.Base(filePath))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to process statement file %s: %w", filePath, err)
 	}
-
 	return transactions, nil
 }
 
-// FromFile reads a manifest from a YAML file.
+// FromFile reads a manifest from a YAML file. Decoding is strict: unknown
+// keys (typos such as acount_id) are errors, and so is a manifest failing
+// Validate.
 func FromFile(filePath string) (*Manifest, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	var manifest Manifest
-	err = yaml.Unmarshal(data, &manifest)
+	manifest, err := Parse(data)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", filePath, err)
 	}
+	return manifest, nil
+}
+
+// Parse strictly decodes and validates a YAML manifest.
+func Parse(data []byte) (*Manifest, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
 
+	var manifest Manifest
+	if err := dec.Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	manifest.applyDefaults()
 	return &manifest, nil
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Source is the content of a statement that is not on disk, such as a file
+// uploaded to the server. A statement with a Source is read from it instead
+// of from FilePath.
+type Source struct {
+	// Name is the file name the statement was uploaded as, reduced by
+	// CleanName. It picks the parser and labels the statement; it is never
+	// opened.
+	Name string
+	Data []byte
+}
+
+// NewSource reads a statement from r. name usually comes from the client, so
+// only its cleaned base name is kept.
+func NewSource(name string, r io.Reader) (*Source, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statement %s: %w", CleanName(name), err)
+	}
+	return &Source{Name: CleanName(name), Data: data}, nil
+}
+
+// CleanName turns an untrusted file name into one safe to log, show and put
+// in headers: the base name, whichever separator the client used, without
+// control characters or quotes. It returns "statement" when nothing is left.
+func CleanName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "statement"
+	}
+	return name
+}
+
+// Name labels the statement in messages: its file, or the name of its
+// in-memory source.
+func (s *Statement) Name() string {
+	if s.Source != nil {
+		return s.Source.Name
+	}
+	return s.FilePath
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanName(t *testing.T) {
+	tests := map[string]string{
+		"Extrato.txt":                 "Extrato.txt",
+		"../../etc/passwd":            "passwd",
+		`C:\Users\me\Fatura.xls`:      "Fatura.xls",
+		"/tmp/":                       "tmp",
+		"..":                          "statement",
+		"":                            "statement",
+		"a\"b\r\nContent-Type: x.csv": "abContent-Type: x.csv",
+	}
+	for in, want := range tests {
+		if got := CleanName(in); got != want {
+			t.Errorf("CleanName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStatementFromSource(t *testing.T) {
+	src, err := NewSource("../uploads/Extrato.txt", strings.NewReader("17/03/2025;PADARIA;-10,00\n18/03/2025;MERCADO;-50,00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &Statement{Source: src, AccountID: "c2a3c7a5-0000-4000-8000-000000000000"}
+	if err := st.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := st.Files(); len(files) != 1 || files[0] != "Extrato.txt" || st.Name() != "Extrato.txt" {
+		t.Fatalf("unexpected files %v and name %q", files, st.Name())
+	}
+	txs, err := st.Transactions(lineParser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(txs))
+	}
+}
@@ -19,8 +19,9 @@ type Transaction struct {
 	docType    string
 	cardType   string
 	cardNumber string
-	lineNumber int // line number in the original file
-	position   int // position within the day
+	payeeAlias string // payee set by a rule; does not change the ID
+	lineNumber int    // line number in the original file
+	position   int    // position within the day
 	err        error
 }
 
@@ -144,7 +145,17 @@ func (t *Transaction) Date() string {
 	return t.date
 }
 
+// SetPayeeAlias replaces the payee shown and sent to YNAB, keeping the ID
+// computed from the payee of the statement so matching is unaffected.
+func (t *Transaction) SetPayeeAlias(payee string) *Transaction {
+	t.payeeAlias = payee
+	return t
+}
+
 func (t *Transaction) Payee() string {
+	if t.payeeAlias != "" {
+		return t.payeeAlias
+	}
 	transformed := strings.TrimSpace(t.payee)
 	if len(transformed) > 5 {
 		if match := strings.LastIndex(transformed, "/"); match > 0 && match == len(transformed)-3 {
@@ -168,6 +179,18 @@ func (t *Transaction) Memo() string {
 	return t.memo
 }
 
+// CardNumber is the card of a fatura transaction, empty for extratos and
+// faturas that do not say.
+func (t *Transaction) CardNumber() string {
+	return t.cardNumber
+}
+
+// CardType is the holder of the card of a fatura transaction: "titular",
+// "adicional" or empty when unknown.
+func (t *Transaction) CardType() string {
+	return t.cardType
+}
+
 func (t *Transaction) Amount() float64 {
 	return t.amount
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// uuidPattern matches YNAB budget and account IDs.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Validate checks what can be checked without touching the disk or YNAB:
+// required fields, enumerations, dates and the shape of IDs. All problems
+// are reported at once.
+func (m *Manifest) Validate() error {
+	if len(m.Statements) == 0 {
+		return errors.New("manifest has no statements")
+	}
+	var errs []error
+	if err := validBudgetID(m.BudgetID); err != nil {
+		errs = append(errs, err)
+	}
+	for i := range m.Statements {
+		if err := m.Statements[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("statement %d: %w", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks a single statement, see Manifest.Validate.
+func (s *Statement) Validate() error {
+	var errs []error
+	if s.FilePath == "" && s.Source == nil {
+		errs = append(errs, errors.New("file is required"))
+	}
+	if s.AccountRef() == "" && len(s.CardAccounts) == 0 {
+		errs = append(errs, errors.New("account or account_id is required"))
+	}
+	if s.AccountID != "" && !uuidPattern.MatchString(s.AccountID) {
+		errs = append(errs, fmt.Errorf("account_id %q is not a YNAB ID; use account for names", s.AccountID))
+	}
+	if err := validBudgetID(s.BudgetID); err != nil {
+		errs = append(errs, err)
+	}
+	switch s.Select {
+	case "", SelectAll, SelectNewest:
+	default:
+		errs = append(errs, fmt.Errorf("select %q must be %s or %s", s.Select, SelectAll, SelectNewest))
+	}
+	switch s.Cleared {
+	case "", "cleared", "uncleared", "reconciled":
+	default:
+		errs = append(errs, fmt.Errorf("cleared %q must be cleared, uncleared or reconciled", s.Cleared))
+	}
+	if _, err := s.Filter.Func(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(append(errs, s.validateCards()...)...)
+}
+
+// validateCards checks that the cards mapping sends every transaction to
+// exactly one account: no card goes to the statement's own account, which
+// already gets the unmapped cards, and no two cards that can match the same
+// transaction go to different accounts.
+func (s *Statement) validateCards() []error {
+	cards := make([]string, 0, len(s.CardAccounts))
+	for card := range s.CardAccounts {
+		cards = append(cards, card)
+	}
+	sort.Strings(cards)
+
+	var errs []error
+	for i, card := range cards {
+		account := s.CardAccounts[card]
+		switch {
+		case account == "":
+			errs = append(errs, fmt.Errorf("cards: %q has no account", card))
+		case account == s.Account || account == s.AccountID:
+			errs = append(errs, fmt.Errorf("cards: %q goes to the statement's own account, which already gets the unmapped cards; leave it out", card))
+		}
+		for _, other := range cards[i+1:] {
+			if s.CardAccounts[other] != account && cardsOverlap(card, other) {
+				errs = append(errs, fmt.Errorf("cards: %q and %q can match the same transaction but go to different accounts; map cards by final digits or by holder, not both", card, other))
+			}
+		}
+	}
+	return errs
+}
+
+// validBudgetID accepts an empty budget_id, a YNAB ID or one of the API's
+// aliases.
+func validBudgetID(id string) error {
+	if id == "" || id == "last-used" || id == "default" || uuidPattern.MatchString(id) {
+		return nil
+	}
+	return fmt.Errorf("budget_id %q is not a YNAB ID, last-used or default; use budget for names", id)
+}
+
+// Schema is the JSON Schema of the manifest, for editors and CI.
+//
+//go:embed manifest.schema.json
+var Schema []byte
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIsStrict(t *testing.T) {
+	_, err := Parse([]byte("statements:\n  - file: a.txt\n    acount_id: x\n"))
+	if err == nil || !strings.Contains(err.Error(), "acount_id") {
+		t.Fatalf("expected an unknown field error, got %v", err)
+	}
+}
+
+func TestParseAppliesManifestBudget(t *testing.T) {
+	m, err := Parse([]byte(`budget: Family
+statements:
+  - file: a.txt
+    account: Itaú
+  - file: b.txt
+    account: Itaú
+    budget: Work
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"Family", "Family"} {
+		if got := m.Statements[i].DefaultBudget; got != want {
+			t.Errorf("statement %d: default budget %q, want %q", i+1, got, want)
+		}
+	}
+	if got := m.Statements[1].BudgetRef(); got != "Work" {
+		t.Errorf("statement budget %q was overridden", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := Parse([]byte(`statements:
+  - file: a.txt
+    account: Itaú
+  - file: b.txt
+    account_id: not-a-uuid
+    select: oldest
+    start: 17/03/2025
+  - account: Itaú
+`))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"statement 2: account_id", "select", "start date", "statement 3: file is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateCards(t *testing.T) {
+	_, err := Parse([]byte(`statements:
+  - file: Fatura.xls
+    account: Cartão Yuri
+    cards:
+      adicional: Cartão Partner
+      "9876": Cartão Partner
+      "76": Cartão Viagem
+      titular: Cartão Yuri
+`))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{
+		`cards: "titular" goes to the statement's own account`,
+		`cards: "76" and "9876" can match the same transaction`,
+		`cards: "76" and "adicional" can match the same transaction`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), `"9876" and "adicional"`) {
+		t.Errorf("cards going to the same account may overlap: %v", err)
+	}
+}
+
+// TestSchemaMatchesStatement keeps the JSON Schema in sync with the YAML
+// keys Statement accepts.
+func TestSchemaMatchesStatement(t *testing.T) {
+	var schema struct {
+		Defs struct {
+			Statement struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"statement"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]bool{}
+	var collect func(reflect.Type)
+	collect = func(rt reflect.Type) {
+		for i := 0; i < rt.NumField(); i++ {
+			tag := rt.Field(i).Tag.Get("yaml")
+			name, opts, _ := strings.Cut(tag, ",")
+			switch {
+			case opts == "inline":
+				collect(rt.Field(i).Type)
+			case name != "" && name != "-":
+				keys[name] = true
+			}
+		}
+	}
+	collect(reflect.TypeOf(Statement{}))
+
+	for k := range keys {
+		if _, ok := schema.Defs.Statement.Properties[k]; !ok {
+			t.Errorf("schema is missing %q", k)
+		}
+	}
+	for k := range schema.Defs.Statement.Properties {
+		if !keys[k] {
+			t.Errorf("schema has %q, which Statement does not accept", k)
+		}
+	}
+}
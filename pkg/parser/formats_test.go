@@ -0,0 +1,29 @@
+package parser
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+)
+
+func TestSchemaListsFormats(t *testing.T) {
+	var schema struct {
+		Defs struct {
+			Statement struct {
+				Properties struct {
+					Format struct {
+						Enum []string `json:"enum"`
+					} `json:"format"`
+				} `json:"properties"`
+			} `json:"statement"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(models.Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if got := schema.Defs.Statement.Properties.Format.Enum; !slices.Equal(got, Formats()) {
+		t.Errorf("schema formats %v, parser formats %v", got, Formats())
+	}
+}
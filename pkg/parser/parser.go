@@ -36,36 +36,83 @@ func setTransactionPositions(transactions []*models.Transaction) {
 	}
 }
 
-func (p *Parser) ProcessBytes(data []byte, filename string) ([]*models.Transaction, error) {
+// Formats a statement can be parsed as, see ProcessBytesAs.
+const (
+	FormatItauFaturaXLS  = "itau-fatura-xls"
+	FormatItauFaturaCSV  = "itau-fatura-csv"
+	FormatItauExtratoTXT = "itau-extrato-txt"
+	FormatItauExtratoOFX = "itau-extrato-ofx"
+	FormatItauExtratoXLS = "itau-extrato-xls"
+	FormatYNABCSV        = "ynab-csv"
+)
+
+// Formats lists every format name accepted by ProcessBytesAs.
+func Formats() []string {
+	return []string{FormatItauFaturaXLS, FormatItauFaturaCSV, FormatItauExtratoTXT, FormatItauExtratoOFX, FormatItauExtratoXLS, FormatYNABCSV}
+}
+
+// DetectFormat guesses the format of a statement from its file name, or
+// returns "" when it cannot.
+func DetectFormat(filename string) string {
 	lowerFilename := strings.ToLower(filename)
+
+	// Check for specific file patterns first (most specific to least specific)
+	switch {
+	case strings.Contains(lowerFilename, "fatura") && strings.HasSuffix(lowerFilename, ".xls"):
+		return FormatItauFaturaXLS
+	case strings.Contains(lowerFilename, "fatura") && strings.HasSuffix(lowerFilename, ".csv"):
+		return FormatItauFaturaCSV
+	case strings.HasSuffix(lowerFilename, ".txt"):
+		return FormatItauExtratoTXT
+	case strings.HasSuffix(lowerFilename, ".ofx"):
+		return FormatItauExtratoOFX
+	case strings.HasSuffix(lowerFilename, ".xls"):
+		return FormatItauExtratoXLS
+	case strings.HasSuffix(lowerFilename, ".csv"):
+		return FormatYNABCSV
+	default:
+		return ""
+	}
+}
+
+func (p *Parser) ProcessBytes(data []byte, filename string) ([]*models.Transaction, error) {
 	p.logger.Info("processing file", "filename", filename)
 
+	format := DetectFormat(filename)
+	if format == "" {
+		p.logger.Info("unknown file type", "filename", filename)
+		return nil, fmt.Errorf("unknown file type")
+	}
+	return p.ProcessBytesAs(data, format)
+}
+
+// ProcessBytesAs parses data as the given format instead of guessing it
+// from the file name.
+func (p *Parser) ProcessBytesAs(data []byte, format string) ([]*models.Transaction, error) {
 	var transactions []*models.Transaction
 	var err error
 
-	// Check for specific file patterns first (most specific to least specific)
-	switch {
-	case strings.Contains(lowerFilename, "fatura") && strings.HasSuffix(lowerFilename, ".xls"):
+	switch format {
+	case FormatItauFaturaXLS:
 		p.logger.Info("using parser: ParseItauFaturaXLS")
 		transactions, err = p.ParseItauFaturaXLS(data)
-	case strings.Contains(lowerFilename, "fatura") && strings.HasSuffix(lowerFilename, ".csv"):
+	case FormatItauFaturaCSV:
 		p.logger.Info("using parser: ParseItauFaturaCSV")
 		transactions, err = p.ParseItauFaturaCSV(data)
-	case strings.HasSuffix(lowerFilename, ".txt"):
+	case FormatItauExtratoTXT:
 		p.logger.Info("using parser: ParseItauExtratoTXT")
 		transactions, err = p.ParseItauExtratoTXT(data)
-	case strings.HasSuffix(lowerFilename, ".ofx"):
+	case FormatItauExtratoOFX:
 		p.logger.Info("using parser: ParseItauExtratoOFX")
 		transactions, err = p.ParseItauExtratoOFX(data)
-	case strings.HasSuffix(lowerFilename, ".xls"):
+	case FormatItauExtratoXLS:
 		p.logger.Info("using parser: ParseItauExtratoXLS")
 		transactions, err = p.ParseItauExtratoXLS(data)
-	case strings.HasSuffix(lowerFilename, ".csv"):
+	case FormatYNABCSV:
 		p.logger.Info("using parser: ParseYNABCSV")
 		transactions, err = p.ParseYNABCSV(data)
 	default:
-		p.logger.Info("unknown file type", "filename", filename)
-		return nil, fmt.Errorf("unknown file type")
+		return nil, fmt.Errorf("unknown format %q (known: %s)", format, strings.Join(Formats(), ", "))
 	}
 
 	if err != nil {
@@ -0,0 +1,101 @@
+// Package rules rewrites or drops parsed statement transactions according to
+// a YAML rules file referenced from a manifest statement:
+//
+//	rules:
+//	  - match: "PIX TRANSF"    # case-insensitive substring of the payee
+//	    payee: "Transfer"      # shown and sent to YNAB instead
+//	  - regex: "^IOF "         # or a regular expression
+//	    skip: true             # drop the transaction
+//
+// The first matching rule wins. Rules never change transaction IDs, so
+// editing them does not make already imported transactions look new.
+package rules
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+)
+
+// Rule matches a transaction by payee and says what to do with it.
+type Rule struct {
+	Match string `yaml:"match"`
+	Regex string `yaml:"regex"`
+	Payee string `yaml:"payee"`
+	Skip  bool   `yaml:"skip"`
+
+	re *regexp.Regexp
+}
+
+// Set is an ordered list of rules.
+type Set struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads and compiles a rules file.
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules %s: %w", path, err)
+	}
+	var set Set
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse rules %s: %w", path, err)
+	}
+	for i := range set.Rules {
+		r := &set.Rules[i]
+		if r.Match == "" && r.Regex == "" {
+			return nil, fmt.Errorf("rules %s: rule %d needs match or regex", path, i+1)
+		}
+		if r.Payee == "" && !r.Skip {
+			return nil, fmt.Errorf("rules %s: rule %d needs payee or skip", path, i+1)
+		}
+		if r.Regex != "" {
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rules %s: rule %d: %w", path, i+1, err)
+			}
+			r.re = re
+		}
+	}
+	return &set, nil
+}
+
+func (r *Rule) matches(payee string) bool {
+	if r.re != nil && !r.re.MatchString(payee) {
+		return false
+	}
+	if r.Match != "" && !strings.Contains(strings.ToLower(payee), strings.ToLower(r.Match)) {
+		return false
+	}
+	return true
+}
+
+// Apply returns txs with skipped transactions removed and payees rewritten.
+func (s *Set) Apply(txs []*models.Transaction) []*models.Transaction {
+	out := make([]*models.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		keep := true
+		for i := range s.Rules {
+			r := &s.Rules[i]
+			if !r.matches(tx.Payee()) {
+				continue
+			}
+			if r.Skip {
+				keep = false
+			} else {
+				tx.SetPayeeAlias(r.Payee)
+			}
+			break
+		}
+		if keep {
+			out = append(out, tx)
+		}
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+)
+
+func TestApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	err := os.WriteFile(path, []byte(`rules:
+  - match: "pix transf"
+    payee: "Transfer"
+  - regex: "^IOF"
+    skip: true
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pix, _ := models.NewTransaction().SetPayee("PIX TRANSF ID_A15/03").SetExtrato().SetDate("17/03/2025").SetValueFromExtrato("-2327,00").Build()
+	iof, _ := models.NewTransaction().SetPayee("IOF COMPRA EXTERIOR").SetExtrato().SetDate("17/03/2025").SetValueFromExtrato("-3,00").Build()
+	id := pix.ID()
+
+	out := set.Apply([]*models.Transaction{pix, iof})
+	if len(out) != 1 || out[0].Payee() != "Transfer" {
+		t.Fatalf("unexpected result %+v", out)
+	}
+	if out[0].ID() != id {
+		t.Error("renaming the payee must not change the transaction ID")
+	}
+}
+
+func TestLoadRejectsIncompleteRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  - match: PIX\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("a rule without payee or skip must be rejected")
+	}
+}
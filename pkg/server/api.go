@@ -0,0 +1,414 @@
+package server
+
+// The versioned JSON API under /api/v1. Responses are typed, shared with the
+// CLI's JSON output where there is one (plan -o json, budgets -o json,
+// accounts -o json), and every failure is an ErrorResponse with one of the
+// Code* values. openapi.json documents it and is served alongside.
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/brunomvsouza/ynab.go/api"
+
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/journal"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/parser"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// openAPI describes the /api/v1 endpoints.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// maxUploadSize caps statement uploads; real statements are a few hundred
+// kilobytes at most.
+const maxUploadSize = 32 << 20
+
+// Error codes of the v1 API, stable for scripts to match on.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeUnauthorized      = "unauthorized"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeParseFailed       = "parse_failed"
+	CodeAmbiguous         = "ambiguous"
+	CodeStalePlan         = "stale_plan"
+	CodeRateLimited       = "rate_limited"
+	CodeBusy              = "busy"
+	CodeUpstream          = "upstream_error"
+	CodeInternal          = "internal_error"
+)
+
+// APIError describes why a v1 request failed.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of every failed v1 request.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// FormatsResponse lists the statement formats the parser understands.
+type FormatsResponse struct {
+	Formats []string `json:"formats"`
+}
+
+// BudgetsResponse lists the budgets of the signed-in user.
+type BudgetsResponse struct {
+	Budgets []ynab.BudgetView `json:"budgets"`
+}
+
+// AccountsResponse lists the accounts of a budget.
+type AccountsResponse struct {
+	BudgetID string             `json:"budget_id"`
+	Accounts []ynab.AccountView `json:"accounts"`
+}
+
+// ParseResponse holds the transactions read from an uploaded statement and
+// where the YNAB CSV built from them can be downloaded.
+type ParseResponse struct {
+	File         string        `json:"file"`
+	Format       string        `json:"format"`
+	Transactions []Transaction `json:"transactions"`
+	Download     string        `json:"download"`
+}
+
+// JobsResponse lists the jobs of the signed-in user, newest first.
+type JobsResponse struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// statementUpload is a statement posted to parse, plan or apply. It is kept
+// in memory; the client's file name only labels it.
+type statementUpload struct {
+	*models.Source
+	format string
+}
+
+func (s *Server) setupV1Routes() {
+	s.mux.HandleFunc("/api/v1/", s.v1("", s.handleV1NotFound))
+	s.mux.HandleFunc("/api/v1/openapi.json", s.v1(http.MethodGet, s.handleV1OpenAPI))
+	s.mux.HandleFunc("/api/v1/formats", s.v1(http.MethodGet, s.handleV1Formats))
+	s.mux.HandleFunc("/api/v1/budgets", s.v1(http.MethodGet, s.handleV1Budgets))
+	s.mux.HandleFunc("/api/v1/budgets/{budget}/accounts", s.v1(http.MethodGet, s.handleV1Accounts))
+	s.mux.HandleFunc("/api/v1/parse", s.v1(http.MethodPost, s.handleV1Parse))
+	s.mux.HandleFunc("/api/v1/plan", s.v1(http.MethodPost, s.handleV1Plan))
+	s.mux.HandleFunc("/api/v1/apply", s.v1(http.MethodPost, s.handleV1Apply))
+	s.mux.HandleFunc("/api/v1/jobs", s.v1(http.MethodGet, s.handleV1Jobs))
+	s.mux.HandleFunc("/api/v1/jobs/{id}", s.v1(http.MethodGet, s.handleV1Job))
+	s.mux.HandleFunc("/api/v1/jobs/{id}/events", s.v1(http.MethodGet, s.handleV1JobEvents))
+}
+
+// v1 wraps a v1 handler with logging, a JSON 405 for other methods than
+// method, when set, and an internal_error for panics.
+func (s *Server) v1(method string, next http.HandlerFunc) http.HandlerFunc {
+	return s.withLogging(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				s.logger.Error("panic recovered", "panic", rec, "method", r.Method, "path", r.URL.Path)
+				s.fail(w, r, http.StatusInternalServerError, CodeInternal, "internal server error", fmt.Errorf("panic: %v", rec))
+			}
+		}()
+		if method != "" && r.Method != method {
+			w.Header().Set("Allow", method)
+			s.fail(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed, use "+method, nil)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) handleV1NotFound(w http.ResponseWriter, r *http.Request) {
+	s.fail(w, r, http.StatusNotFound, CodeNotFound, "no such endpoint, see /api/v1/openapi.json", nil)
+}
+
+func (s *Server) handleV1OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPI); err != nil {
+		s.logger.Warn("failed to write openapi document", "err", err)
+	}
+}
+
+func (s *Server) handleV1Formats(w http.ResponseWriter, r *http.Request) {
+	s.respond(w, FormatsResponse{Formats: parser.Formats()})
+}
+
+func (s *Server) handleV1Budgets(w http.ResponseWriter, r *http.Request) {
+	client, ok := s.v1Client(w, r)
+	if !ok {
+		return
+	}
+	budgets, err := client.GetBudgets()
+	if err != nil {
+		s.failWith(w, r, "failed to fetch budgets", err)
+		return
+	}
+	s.respond(w, BudgetsResponse{Budgets: ynab.NewBudgetViews(budgets)})
+}
+
+// handleV1Accounts lists the accounts of a budget given by ID, name or
+// last-used; closed accounts are left out unless ?closed=true.
+func (s *Server) handleV1Accounts(w http.ResponseWriter, r *http.Request) {
+	client, ok := s.v1Client(w, r)
+	if !ok {
+		return
+	}
+	budgetID, err := ynab.NewResolver(client).Budget(r.PathValue("budget"))
+	if err != nil {
+		s.failWith(w, r, "failed to resolve budget", err)
+		return
+	}
+	accounts, err := client.GetAccounts(budgetID)
+	if err != nil {
+		s.failWith(w, r, "failed to fetch accounts", err)
+		return
+	}
+	closed := r.URL.Query().Get("closed") == "true"
+	s.respond(w, AccountsResponse{BudgetID: budgetID, Accounts: ynab.NewAccountViews(accounts, closed)})
+}
+
+// handleV1Parse converts a statement without talking to YNAB, so it needs no
+// token.
+func (s *Server) handleV1Parse(w http.ResponseWriter, r *http.Request) {
+	up, ok := s.readUpload(w, r)
+	if !ok {
+		return
+	}
+	local, ok := s.parseUpload(w, r, up)
+	if !ok {
+		return
+	}
+	s.respond(w, ParseResponse{
+		File:         up.Name,
+		Format:       up.format,
+		Transactions: transactionViews(local),
+		Download:     s.storeCSV(s.scope(r), up.Name, local),
+	})
+}
+
+// handleV1Plan reconciles a statement against an account and returns the
+// same document as `ynabu plan -o json`.
+func (s *Server) handleV1Plan(w http.ResponseWriter, r *http.Request) {
+	client, ok := s.v1Client(w, r)
+	if !ok {
+		return
+	}
+	up, ok := s.readUpload(w, r)
+	if !ok {
+		return
+	}
+	account := r.FormValue("account")
+	if account == "" {
+		s.fail(w, r, http.StatusBadRequest, CodeBadRequest, "account required (name or ID)", nil)
+		return
+	}
+	exec := executors.New(s.logger, s.config, client)
+	report, err := exec.Plan(&models.Statement{Source: up.Source, Format: up.format, Budget: r.FormValue("budget"), Account: account})
+	if err != nil {
+		s.failWith(w, r, "failed to reconcile statement", err)
+		return
+	}
+	s.respond(w, executors.NewPlanView([]*executors.Report{report}))
+}
+
+// handleV1Apply starts a job creating the missing transactions of a
+// statement and returns it, queued, with 202. Follow it at /jobs/{id} or
+// /jobs/{id}/events; a job failing half-way may still have created some
+// transactions, see Job.Created.
+func (s *Server) handleV1Apply(w http.ResponseWriter, r *http.Request) {
+	token, err := s.token(r)
+	if err != nil {
+		s.fail(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error(), nil)
+		return
+	}
+	up, ok := s.readUpload(w, r)
+	if !ok {
+		return
+	}
+	account := r.FormValue("account")
+	if account == "" {
+		s.fail(w, r, http.StatusBadRequest, CodeBadRequest, "account required (name or ID)", nil)
+		return
+	}
+
+	budget := r.FormValue("budget")
+	job, err := s.start(&Job{Kind: string(journal.KindApply), File: up.Name, owner: s.owner(r, token)}, func(t *task) error {
+		return s.runApply(t, token, func(exec *executors.Executor) error {
+			return exec.Apply(&models.Statement{Source: up.Source, Format: up.format, Budget: budget, Account: account})
+		})
+	})
+	if err != nil {
+		w.Header().Set("Retry-After", retryBusy)
+		s.failWith(w, r, "failed to start the job", err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	if err := s.writeJSON(w, http.StatusAccepted, job); err != nil {
+		s.logger.Warn("failed to write json response", "err", err)
+	}
+}
+
+func (s *Server) handleV1Jobs(w http.ResponseWriter, r *http.Request) {
+	token, err := s.token(r)
+	if err != nil {
+		s.fail(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error(), nil)
+		return
+	}
+	s.respond(w, JobsResponse{Jobs: s.jobs.list(s.owner(r, token))})
+}
+
+func (s *Server) handleV1Job(w http.ResponseWriter, r *http.Request) {
+	token, err := s.token(r)
+	if err != nil {
+		s.fail(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error(), nil)
+		return
+	}
+	job, ok := s.jobs.get(s.owner(r, token), r.PathValue("id"))
+	if !ok {
+		s.fail(w, r, http.StatusNotFound, CodeNotFound, "no such job", nil)
+		return
+	}
+	s.respond(w, job)
+}
+
+func (s *Server) handleV1JobEvents(w http.ResponseWriter, r *http.Request) {
+	token, err := s.token(r)
+	if err != nil {
+		s.fail(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error(), nil)
+		return
+	}
+	if !s.streamJob(w, r, s.owner(r, token), r.PathValue("id")) {
+		s.fail(w, r, http.StatusNotFound, CodeNotFound, "no such job", nil)
+	}
+}
+
+// --- helpers ---
+
+// v1Client returns a YNAB client for the token of the request, or fails it.
+func (s *Server) v1Client(w http.ResponseWriter, r *http.Request) (ynab.Client, bool) {
+	token, err := s.token(r)
+	if err != nil {
+		s.fail(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error(), nil)
+		return nil, false
+	}
+	return s.newClient(token), true
+}
+
+// readUpload reads the "statement" file of a multipart request. Its format
+// is the "format" field, or is detected from the file name.
+func (s *Server) readUpload(w http.ResponseWriter, r *http.Request) (*statementUpload, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("statement")
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, CodeBadRequest, "statement file required", err)
+		return nil, false
+	}
+	defer file.Close()
+	src, err := models.NewSource(header.Filename, file)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, CodeBadRequest, "failed to read statement", err)
+		return nil, false
+	}
+
+	up := &statementUpload{Source: src, format: r.FormValue("format")}
+	if up.format == "" {
+		up.format = parser.DetectFormat(up.Name)
+	}
+	if !slices.Contains(parser.Formats(), up.format) {
+		s.fail(w, r, http.StatusBadRequest, CodeUnsupportedFormat,
+			fmt.Sprintf("cannot tell the format of %q, set format to one of: %s", up.Name, strings.Join(parser.Formats(), ", ")), nil)
+		return nil, false
+	}
+	return up, true
+}
+
+// parseUpload parses an upload, sorted by date like the CSV export.
+func (s *Server) parseUpload(w http.ResponseWriter, r *http.Request, up *statementUpload) ([]*models.Transaction, bool) {
+	local, err := s.parse(up.Data, up.format)
+	if err != nil {
+		s.fail(w, r, http.StatusUnprocessableEntity, CodeParseFailed, fmt.Sprintf("failed to parse %s as %s: %v", up.Name, up.format, err), nil)
+		return nil, false
+	}
+	sort.Slice(local, func(i, j int) bool { return local[i].Date() < local[j].Date() })
+	return local, true
+}
+
+// respond writes a successful v1 response.
+func (s *Server) respond(w http.ResponseWriter, v any) {
+	if err := s.writeJSON(w, http.StatusOK, v); err != nil {
+		s.logger.Warn("failed to write json response", "err", err)
+	}
+}
+
+// fail logs err and writes an ErrorResponse.
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, status int, code, message string, err error) {
+	if err != nil {
+		s.logger.Warn("request error", "status", status, "code", code, "msg", message, "err", err, "method", r.Method, "path", r.URL.Path)
+	} else {
+		s.logger.Warn("request error", "status", status, "code", code, "msg", message, "method", r.Method, "path", r.URL.Path)
+	}
+	_ = s.writeJSON(w, status, ErrorResponse{Error: APIError{Code: code, Message: message}})
+}
+
+// failWith fails a request with the status and code matching err, which
+// came from resolving names or from YNAB.
+func (s *Server) failWith(w http.ResponseWriter, r *http.Request, message string, err error) {
+	status, apiErr := classify(err)
+	apiErr.Message = message + ": " + apiErr.Message
+	s.fail(w, r, status, apiErr.Code, apiErr.Message, nil)
+}
+
+// classify maps an error to the HTTP status and APIError reported for it.
+func classify(err error) (int, APIError) {
+	var (
+		notFound  *ynab.NotFoundError
+		ambiguous *ynab.AmbiguousError
+		invalid   *executors.StatementError
+		ynabErr   *api.Error
+	)
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound, APIError{Code: CodeNotFound, Message: err.Error()}
+	case errors.As(err, &ambiguous):
+		return http.StatusBadRequest, APIError{Code: CodeAmbiguous, Message: err.Error()}
+	case errors.As(err, &invalid) && invalid.Parse:
+		return http.StatusUnprocessableEntity, APIError{Code: CodeParseFailed, Message: err.Error()}
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: err.Error()}
+	case errors.Is(err, errBusy):
+		return http.StatusServiceUnavailable, APIError{Code: CodeBusy, Message: err.Error()}
+	case errors.Is(err, executors.ErrStalePlan):
+		return http.StatusConflict, APIError{Code: CodeStalePlan, Message: err.Error()}
+	case errors.As(err, &ynabErr):
+		// YNAB error IDs start with the HTTP status, e.g. "404.2".
+		switch {
+		case strings.HasPrefix(ynabErr.ID, "401"):
+			return http.StatusUnauthorized, APIError{Code: CodeUnauthorized, Message: err.Error()}
+		case strings.HasPrefix(ynabErr.ID, "404"):
+			return http.StatusNotFound, APIError{Code: CodeNotFound, Message: err.Error()}
+		case strings.HasPrefix(ynabErr.ID, "429"):
+			return http.StatusTooManyRequests, APIError{Code: CodeRateLimited, Message: err.Error()}
+		}
+	}
+	return http.StatusBadGateway, APIError{Code: CodeUpstream, Message: err.Error()}
+}
+
+// transactionViews converts parsed transactions for JSON responses.
+func transactionViews(local []*models.Transaction) []Transaction {
+	txs := make([]Transaction, len(local))
+	for i, t := range local {
+		txs[i] = Transaction{ID: t.ID(), Date: t.Date(), Payee: t.Payee(), Memo: t.Memo(), Amount: t.Amount(), Line: t.LineNumber()}
+	}
+	return txs
+}
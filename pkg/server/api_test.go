@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/brunomvsouza/ynab.go/api"
+
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/parser"
+)
+
+// call sends a v1 request and decodes the response into out, returning the
+// status. fields, when not nil, are posted as a multipart form with the
+// extrato as the statement file name.
+func call(t *testing.T, method, url, token, name string, fields map[string]string, out any) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	req, _ := http.NewRequest(method, url, nil)
+	if fields != nil {
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("statement", name)
+		fw.Write([]byte(extrato))
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		mw.Close()
+		req, _ = http.NewRequest(method, url, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return res.StatusCode
+}
+
+func TestV1PlanApplyAndJobs(t *testing.T) {
+	ts, client := newTestServer(t)
+	fields := map[string]string{"budget": "Family", "account": "Itaú Conta Corrente"}
+
+	var parsed ParseResponse
+	if status := call(t, http.MethodPost, ts.URL+"/api/v1/parse", "", "extrato.txt", map[string]string{}, &parsed); status != http.StatusOK {
+		t.Fatalf("parse: status %d", status)
+	}
+	if parsed.Format != parser.FormatItauExtratoTXT || len(parsed.Transactions) != 3 || parsed.Download == "" {
+		t.Fatalf("unexpected parse response %+v", parsed)
+	}
+
+	// The CSV is only served to whoever uploaded the statement.
+	for token, want := range map[string]int{"": http.StatusOK, "someone-else": http.StatusNotFound} {
+		res, err := get(t, ts.URL+parsed.Download, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Errorf("download with token %q: status %d, want %d", token, res.StatusCode, want)
+		}
+	}
+
+	var plan executors.PlanView
+	if status := call(t, http.MethodPost, ts.URL+"/api/v1/plan", "t", "extrato.txt", fields, &plan); status != http.StatusOK {
+		t.Fatalf("plan: status %d", status)
+	}
+	if plan.Summary.ToAdd != 3 || plan.Reports[0].BudgetID != "budget-1" || plan.Reports[0].AccountID != "account-1" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	var queued Job
+	if status := call(t, http.MethodPost, ts.URL+"/api/v1/apply", "t", "extrato.txt", fields, &queued); status != http.StatusAccepted {
+		t.Fatalf("apply: status %d", status)
+	}
+	job, events := follow(t, ts.URL+"/api/v1/jobs/"+queued.ID+"/events")
+	if job.ID != queued.ID || job.Status != JobSucceeded || job.Created != 3 || job.AccountID != "account-1" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if !slices.Contains(events, EventProgress) {
+		t.Errorf("no progress among events %v", events)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 3 {
+		t.Fatalf("expected 3 remote transactions, got %d", got)
+	}
+
+	var jobs JobsResponse
+	call(t, http.MethodGet, ts.URL+"/api/v1/jobs", "t", "", nil, &jobs)
+	if len(jobs.Jobs) != 1 || jobs.Jobs[0].ID != job.ID {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+	var got Job
+	if status := call(t, http.MethodGet, ts.URL+"/api/v1/jobs/"+job.ID, "t", "", nil, &got); status != http.StatusOK || got.ID != job.ID {
+		t.Fatalf("job: status %d, %+v", status, got)
+	}
+	// Jobs are only visible to whoever started them.
+	var e ErrorResponse
+	if status := call(t, http.MethodGet, ts.URL+"/api/v1/jobs/"+job.ID, "someone-else", "", nil, &e); status != http.StatusNotFound {
+		t.Fatalf("job of another token: status %d", status)
+	}
+}
+
+func TestV1ApplyKeepsUploadsInMemory(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	ts, client := newTestServer(t)
+
+	var job Job
+	fields := map[string]string{"account": "account-1"}
+	if status := call(t, http.MethodPost, ts.URL+"/api/v1/apply", "t", "../../uploads/extrato.txt", fields, &job); status != http.StatusAccepted {
+		t.Fatalf("apply: status %d", status)
+	}
+	job, _ = follow(t, ts.URL+"/api/v1/jobs/"+job.ID+"/events")
+	if job.Status != JobSucceeded || job.File != "extrato.txt" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 3 {
+		t.Fatalf("expected 3 remote transactions, got %d", got)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Fatalf("apply wrote %d file(s) to the temp dir", len(entries))
+	}
+}
+
+func TestV1Errors(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	tests := []struct {
+		name, method, path, token, file string
+		fields                          map[string]string
+		status                          int
+		code                            string
+	}{
+		{"no token", http.MethodGet, "/api/v1/budgets", "", "", nil, http.StatusUnauthorized, CodeUnauthorized},
+		{"wrong method", http.MethodPost, "/api/v1/formats", "", "", nil, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{"unknown endpoint", http.MethodGet, "/api/v1/nope", "", "", nil, http.StatusNotFound, CodeNotFound},
+		{"unknown budget", http.MethodGet, "/api/v1/budgets/Work/accounts", "t", "", nil, http.StatusNotFound, CodeNotFound},
+		{"unknown format", http.MethodPost, "/api/v1/parse", "", "statement.pdf", map[string]string{}, http.StatusBadRequest, CodeUnsupportedFormat},
+		{"parse failure", http.MethodPost, "/api/v1/parse", "", "extrato.ofx", map[string]string{}, http.StatusUnprocessableEntity, CodeParseFailed},
+		{"no account", http.MethodPost, "/api/v1/plan", "t", "extrato.txt", map[string]string{}, http.StatusBadRequest, CodeBadRequest},
+		{"unknown account", http.MethodPost, "/api/v1/plan", "t", "extrato.txt", map[string]string{"account": "Savings"}, http.StatusNotFound, CodeNotFound},
+		{"plan parse failure", http.MethodPost, "/api/v1/plan", "t", "extrato.ofx", map[string]string{"account": "Itaú Conta Corrente"}, http.StatusUnprocessableEntity, CodeParseFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e ErrorResponse
+			status := call(t, tt.method, ts.URL+tt.path, tt.token, tt.file, tt.fields, &e)
+			if status != tt.status || e.Error.Code != tt.code || e.Error.Message == "" {
+				t.Fatalf("got %d %+v, want %d %s", status, e.Error, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+// TestV1ApplyParseFailure checks that a statement failing to parse fails
+// the apply job, which only parses it once started.
+func TestV1ApplyParseFailure(t *testing.T) {
+	ts, client := newTestServer(t)
+
+	var job Job
+	fields := map[string]string{"account": "account-1"}
+	if status := call(t, http.MethodPost, ts.URL+"/api/v1/apply", "t", "extrato.ofx", fields, &job); status != http.StatusAccepted {
+		t.Fatalf("apply: status %d", status)
+	}
+	job, _ = follow(t, ts.URL+"/api/v1/jobs/"+job.ID+"/events")
+	if job.Status != JobFailed || job.Error == nil || job.Error.Code != CodeParseFailed {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 0 {
+		t.Fatalf("expected no remote transactions, got %d", got)
+	}
+}
+
+func TestClassifyStatementErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{&executors.StatementError{Err: errors.New("bad line 3"), Parse: true}, http.StatusUnprocessableEntity, CodeParseFailed},
+		{fmt.Errorf("apply: %w", &executors.StatementError{Err: errors.New("invalid cleared")}), http.StatusBadRequest, CodeBadRequest},
+		{&api.Error{ID: "500", Name: "internal_server_error"}, http.StatusBadGateway, CodeUpstream},
+	}
+	for _, tt := range tests {
+		if status, apiErr := classify(tt.err); status != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%v: got %d %s, want %d %s", tt.err, status, apiErr.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	var doc struct {
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas struct {
+				Format struct {
+					Enum []string `json:"enum"`
+				} `json:"Format"`
+				Error struct {
+					Properties struct {
+						Code struct {
+							Enum []string `json:"enum"`
+						} `json:"code"`
+					} `json:"properties"`
+				} `json:"Error"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if status := call(t, http.MethodGet, ts.URL+"/api/v1/openapi.json", "", "", nil, &doc); status != http.StatusOK {
+		t.Fatalf("openapi.json: status %d", status)
+	}
+
+	routes := map[string]string{
+		"/formats":                   "get",
+		"/budgets":                   "get",
+		"/budgets/{budget}/accounts": "get",
+		"/parse":                     "post",
+		"/plan":                      "post",
+		"/apply":                     "post",
+		"/jobs":                      "get",
+		"/jobs/{id}":                 "get",
+		"/jobs/{id}/events":          "get",
+		"/openapi.json":              "get",
+	}
+	for path, method := range routes {
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("%s %s is not documented", strings.ToUpper(method), path)
+		}
+	}
+	if len(doc.Paths) != len(routes) {
+		t.Errorf("documented %d paths, serving %d", len(doc.Paths), len(routes))
+	}
+	if got := doc.Components.Schemas.Format.Enum; !slices.Equal(got, parser.Formats()) {
+		t.Errorf("documented formats %v, parser formats %v", got, parser.Formats())
+	}
+	codes := []string{CodeBadRequest, CodeUnauthorized, CodeNotFound, CodeMethodNotAllowed, CodeUnsupportedFormat,
+		CodeParseFailed, CodeAmbiguous, CodeStalePlan, CodeRateLimited, CodeBusy, CodeUpstream, CodeInternal}
+	if got := doc.Components.Schemas.Error.Properties.Code.Enum; !slices.Equal(got, codes) {
+		t.Errorf("documented error codes %v, want %v", got, codes)
+	}
+}
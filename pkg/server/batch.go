@@ -0,0 +1,193 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/models"
+	"github.com/yurifrl/ynabu/pkg/parser"
+)
+
+// maxBatchFiles bounds how many statements one request may upload.
+const maxBatchFiles = 20
+
+// The web UI uploads every statement of a month at once as "statement"
+// files and maps each to an account with form fields:
+//
+//	account_id.<n>         the account of the n-th file (from 0)
+//	account_id.<n>.<card>  the account of one card of the n-th file, a fatura
+//	account_id             the account of files without their own
+//
+// A fatura is split into one section per card, so cards paid from different
+// accounts can be reconciled separately, like the cards mapping of a
+// manifest does.
+
+// batchFile is an uploaded statement and its sections.
+type batchFile struct {
+	up       *statementUpload
+	local    []*models.Transaction
+	sections []*batchSection
+	err      error
+}
+
+// batchSection is the part of a statement that goes to one account: a whole
+// extrato, or the transactions of one card of a fatura.
+type batchSection struct {
+	// Card is the card number (or holder) of the section, empty for
+	// extratos and faturas without card information.
+	Card string
+	// Key is what the UI remembers the account of the section under: the
+	// format, plus the card for faturas.
+	Key     string
+	Account string
+	local   []*models.Transaction
+	// numbered tells whether Card is a card number rather than a holder.
+	numbered bool
+}
+
+// filter selects the transactions of sec when its statement is parsed
+// again, splitting them as sections does: by card number when there is one,
+// by holder otherwise.
+func (sec *batchSection) filter(all []*batchSection) models.Filter {
+	var f models.Filter
+	if sec.Card != "" {
+		f.Cards = []string{sec.Card}
+	}
+	for _, other := range all {
+		if other == sec || other.Card == "" {
+			continue
+		}
+		// A numbered card also has a holder, so holder and unsorted
+		// sections leave the numbered ones out.
+		if sec.Card == "" || (!sec.numbered && other.numbered) {
+			f.ExcludeCards = append(f.ExcludeCards, other.Card)
+		}
+	}
+	return f
+}
+
+// FileView describes an uploaded statement in /api/process responses.
+type FileView struct {
+	Index        int           `json:"index"`
+	Name         string        `json:"name"`
+	Format       string        `json:"format,omitempty"`
+	Download     string        `json:"download,omitempty"`
+	Transactions []Transaction `json:"transactions"`
+	Sections     []SectionView `json:"sections"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// SectionView is a section of an uploaded statement and, once it has an
+// account, its reconciliation.
+type SectionView struct {
+	Card      string `json:"card,omitempty"`
+	Key       string `json:"key"`
+	Field     string `json:"field"`
+	AccountID string `json:"account_id,omitempty"`
+	// Transactions are those of the section, shown until it is reconciled.
+	Transactions []Transaction         `json:"transactions"`
+	Plan         *executors.ReportView `json:"plan,omitempty"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// readBatch reads and parses every uploaded statement and assigns the
+// sections their accounts. Files that cannot be parsed carry the error
+// instead of sections.
+func (s *Server) readBatch(w http.ResponseWriter, r *http.Request) ([]*batchFile, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	headers := r.MultipartForm.File["statement"]
+	switch {
+	case len(headers) == 0:
+		return nil, fmt.Errorf("statement file required")
+	case len(headers) > maxBatchFiles:
+		return nil, fmt.Errorf("at most %d statements per upload", maxBatchFiles)
+	}
+
+	files := make([]*batchFile, len(headers))
+	for i, header := range headers {
+		f, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", models.CleanName(header.Filename), err)
+		}
+		src, err := models.NewSource(header.Filename, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		bf := &batchFile{up: &statementUpload{Source: src, format: parser.DetectFormat(src.Name)}}
+		files[i] = bf
+
+		if bf.up.format == "" {
+			bf.err = fmt.Errorf("unknown file type")
+			continue
+		}
+		bf.local, bf.err = s.parse(bf.up.Data, bf.up.format)
+		if bf.err != nil {
+			continue
+		}
+		sort.Slice(bf.local, func(i, j int) bool { return bf.local[i].Date() < bf.local[j].Date() })
+		bf.sections = sections(bf.up.format, bf.local)
+		for _, sec := range bf.sections {
+			sec.Account = firstValue(r, sectionField(i, sec.Card), sectionField(i, ""), "account_id")
+		}
+	}
+	return files, nil
+}
+
+// sections splits parsed transactions by card, in order of first
+// appearance.
+func sections(format string, local []*models.Transaction) []*batchSection {
+	var list []*batchSection
+	byCard := make(map[string]*batchSection)
+	for _, t := range local {
+		card := cardOf(t)
+		sec, ok := byCard[card]
+		if !ok {
+			sec = &batchSection{Card: card, Key: format, numbered: t.CardNumber() != ""}
+			if card != "" {
+				sec.Key += ":" + card
+			}
+			byCard[card] = sec
+			list = append(list, sec)
+		}
+		sec.local = append(sec.local, t)
+	}
+	if len(list) == 0 {
+		list = append(list, &batchSection{Key: format})
+	}
+	return list
+}
+
+// cardOf is the card a fatura transaction was made with: its number, or its
+// holder when the statement has no numbers.
+func cardOf(t *models.Transaction) string {
+	if t.CardNumber() != "" {
+		return t.CardNumber()
+	}
+	return t.CardType()
+}
+
+// sectionField is the form field holding the account of a section.
+func sectionField(index int, card string) string {
+	field := "account_id." + strconv.Itoa(index)
+	if card != "" {
+		field += "." + card
+	}
+	return field
+}
+
+// firstValue returns the first non-empty form value of fields.
+func firstValue(r *http.Request, fields ...string) string {
+	for _, f := range fields {
+		if v := r.FormValue(f); v != "" {
+			return v
+		}
+	}
+	return ""
+}
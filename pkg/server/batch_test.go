@@ -0,0 +1,41 @@
+package server
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yurifrl/ynabu/pkg/models"
+)
+
+// TestSectionFilters checks that parsing a fatura again with the filter of
+// each section gives back exactly the transactions of that section.
+func TestSectionFilters(t *testing.T) {
+	fatura := func(holder, number string) *models.Transaction {
+		tx, err := models.NewTransaction().SetPayee("POSTO").SetFatura(holder, number).SetDate("17/03/2025").SetValueFromFatura("100,00").Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	local := []*models.Transaction{
+		fatura("titular", "1234"),
+		fatura("adicional", "9876"),
+		fatura("titular", ""),
+		fatura("", ""),
+		fatura("titular", "1234"),
+	}
+
+	secs := sections("itau_fatura_xls", local)
+	if len(secs) != 4 {
+		t.Fatalf("expected 4 sections, got %d", len(secs))
+	}
+	for _, sec := range secs {
+		got, err := sec.filter(secs).Apply(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, sec.local) {
+			t.Errorf("section %q: filter keeps %d transactions, want its %d", sec.Card, len(got), len(sec.local))
+		}
+	}
+}
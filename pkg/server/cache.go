@@ -0,0 +1,162 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// downloadTTL is how long the CSV of a processed statement can be
+	// downloaded.
+	downloadTTL = time.Hour
+	// maxDownloadBytes bounds the memory the CSVs of all users take; the
+	// least recently used are dropped first.
+	maxDownloadBytes = 64 << 20
+	// maxOwnerDownloadBytes bounds the memory the CSVs of a single user
+	// take, so one user's uploads do not push out everyone else's.
+	maxOwnerDownloadBytes = 8 << 20
+)
+
+// download is the YNAB CSV of a processed statement.
+type download struct {
+	id      string
+	owner   string
+	name    string
+	data    []byte
+	expires time.Time
+}
+
+// cacheStats describes the memory a cache uses and how well it does.
+type cacheStats struct {
+	Entries   int
+	Bytes     int64
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// downloads is an in-memory LRU cache of CSVs by random ID, bounded in
+// bytes overall and per owner, whose entries expire and are only served to
+// whoever created them.
+type downloads struct {
+	mu            sync.Mutex
+	now           func() time.Time
+	maxBytes      int64
+	maxOwnerBytes int64
+	ttl           time.Duration
+	lru           *list.List // of *download, most recently used first
+	byID          map[string]*list.Element
+	byOwner       map[string]int64 // bytes
+	stats         cacheStats
+}
+
+func newDownloads(maxBytes, maxOwnerBytes int64, ttl time.Duration) *downloads {
+	return &downloads{
+		now:           time.Now,
+		maxBytes:      maxBytes,
+		maxOwnerBytes: maxOwnerBytes,
+		ttl:           ttl,
+		lru:           list.New(),
+		byID:          make(map[string]*list.Element),
+		byOwner:       make(map[string]int64),
+	}
+}
+
+// add stores a CSV of owner and returns its ID. Room is made by dropping
+// the least recently used CSVs of owner while over its share, then those of
+// whoever takes the most memory, so nobody loses CSVs to a user holding
+// less than them. A CSV larger than a share is not stored, and "" is
+// returned.
+func (d *downloads) add(owner, name string, data []byte) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	size := int64(len(data))
+	if size > d.maxBytes || size > d.maxOwnerBytes {
+		return ""
+	}
+	d.expire()
+	for d.byOwner[owner]+size > d.maxOwnerBytes {
+		d.remove(d.oldest(owner))
+		d.stats.Evictions++
+	}
+	for d.stats.Bytes+size > d.maxBytes {
+		d.remove(d.oldest(d.largest()))
+		d.stats.Evictions++
+	}
+
+	dl := &download{id: newID(), owner: owner, name: name, data: data, expires: d.now().Add(d.ttl)}
+	d.byID[dl.id] = d.lru.PushFront(dl)
+	d.byOwner[owner] += size
+	d.stats.Entries++
+	d.stats.Bytes += size
+	return dl.id
+}
+
+// oldest returns the least recently used CSV of owner.
+func (d *downloads) oldest(owner string) *list.Element {
+	for el := d.lru.Back(); el != nil; el = el.Prev() {
+		if el.Value.(*download).owner == owner {
+			return el
+		}
+	}
+	return nil
+}
+
+// largest returns the owner whose CSVs take the most memory.
+func (d *downloads) largest() string {
+	var owner string
+	for o, n := range d.byOwner {
+		if n > d.byOwner[owner] || (n == d.byOwner[owner] && o < owner) {
+			owner = o
+		}
+	}
+	return owner
+}
+
+// get returns a CSV of owner that has not expired.
+func (d *downloads) get(owner, id string) (*download, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire()
+	el, ok := d.byID[id]
+	if !ok || el.Value.(*download).owner != owner {
+		d.stats.Misses++
+		return nil, false
+	}
+	d.stats.Hits++
+	d.lru.MoveToFront(el)
+	return el.Value.(*download), true
+}
+
+// snapshot returns the current statistics.
+func (d *downloads) snapshot() cacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire()
+	return d.stats
+}
+
+// expire drops expired entries. Recently used entries may be older than
+// less recently used ones, so every entry is checked.
+func (d *downloads) expire() {
+	now := d.now()
+	for el := d.lru.Front(); el != nil; {
+		next := el.Next()
+		if !now.Before(el.Value.(*download).expires) {
+			d.remove(el)
+		}
+		el = next
+	}
+}
+
+func (d *downloads) remove(el *list.Element) {
+	dl := d.lru.Remove(el).(*download)
+	delete(d.byID, dl.id)
+	d.byOwner[dl.owner] -= int64(len(dl.data))
+	if d.byOwner[dl.owner] == 0 {
+		delete(d.byOwner, dl.owner)
+	}
+	d.stats.Entries--
+	d.stats.Bytes -= int64(len(dl.data))
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownloadsEvictLeastRecentlyUsed(t *testing.T) {
+	d := newDownloads(10, 10, time.Hour)
+
+	a := d.add("alice", "a.csv", []byte("aaaa"))
+	b := d.add("alice", "b.csv", []byte("bbbb"))
+	if _, ok := d.get("alice", a); !ok {
+		t.Fatal("a should be cached")
+	}
+	// c does not fit next to a and b: b, the least recently used, goes.
+	c := d.add("alice", "c.csv", []byte("cccc"))
+	if _, ok := d.get("alice", b); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, id := range []string{a, c} {
+		if _, ok := d.get("alice", id); !ok {
+			t.Errorf("%s should be cached", id)
+		}
+	}
+	if id := d.add("alice", "huge.csv", make([]byte, 11)); id != "" {
+		t.Error("a CSV larger than the cache should not be stored")
+	}
+
+	stats := d.snapshot()
+	if stats.Entries != 2 || stats.Bytes != 8 || stats.Evictions != 1 || stats.Misses != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDownloadsKeepOwnersApart(t *testing.T) {
+	d := newDownloads(12, 8, time.Hour)
+
+	b := d.add("bob", "b.csv", []byte("bbbb"))
+	var alice []string
+	for range 5 {
+		alice = append(alice, d.add("alice", "a.csv", []byte("aaaa")))
+	}
+	if _, ok := d.get("bob", b); !ok {
+		t.Fatal("alice's downloads evicted bob's")
+	}
+	for i, id := range alice {
+		if _, ok := d.get("alice", id); ok != (i >= 3) {
+			t.Errorf("alice's download %d cached: %v, only her last 2 fit her share", i, ok)
+		}
+	}
+
+	// When the cache is full, whoever takes the most gives way.
+	d.add("carol", "c.csv", []byte("cccc"))
+	if _, ok := d.get("bob", b); !ok {
+		t.Error("carol's download evicted bob's, who takes less than alice")
+	}
+	if stats := d.snapshot(); stats.Bytes != 12 || stats.Evictions != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDownloadsExpireAndStayWithTheirOwner(t *testing.T) {
+	now := time.Now()
+	d := newDownloads(1<<10, 1<<10, time.Minute)
+	d.now = func() time.Time { return now }
+
+	id := d.add("alice", "a.csv", []byte("a"))
+	if _, ok := d.get("bob", id); ok {
+		t.Error("bob can read alice's download")
+	}
+	if dl, ok := d.get("alice", id); !ok || dl.name != "a.csv" {
+		t.Fatalf("alice cannot read her download: %+v", dl)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := d.get("alice", id); ok {
+		t.Error("expired download still served")
+	}
+	if stats := d.snapshot(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("expired download still counted: %+v", stats)
+	}
+}
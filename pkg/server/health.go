@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// handleHealthz answers as long as the server serves requests, for liveness
+// probes.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if err := s.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"}); err != nil {
+		s.logger.Warn("failed to write json response", "err", err)
+	}
+}
+
+// handleReadyz reports whether the server can serve users, for readiness
+// probes: 200 when every check passes, 503 listing them otherwise.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status, code := "ok", http.StatusOK
+	checks := map[string]string{}
+	for name, err := range s.ready() {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = err.Error()
+			status, code = "error", http.StatusServiceUnavailable
+		}
+	}
+	if code != http.StatusOK {
+		s.logger.Warn("not ready", "checks", checks)
+	}
+	if err := s.writeJSON(w, code, map[string]any{"status": status, "checks": checks}); err != nil {
+		s.logger.Warn("failed to write json response", "err", err)
+	}
+}
+
+// ready runs the readiness checks: the page template is loaded and, when
+// sessions are kept on disk, their directory can still be written, since
+// nobody could sign in otherwise.
+func (s *Server) ready() map[string]error {
+	checks := map[string]error{"templates": nil}
+	if s.template == nil || s.template.Lookup("index.html") == nil {
+		checks["templates"] = fmt.Errorf("index.html not loaded")
+	}
+	if s.sessions.dir != "" {
+		checks["sessions"] = s.sessions.writable()
+	}
+	return checks
+}
+
+// handleMetrics serves the metrics in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w, s.downloads.snapshot())
+}
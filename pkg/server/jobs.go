@@ -0,0 +1,355 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yurifrl/ynabu/pkg/executors"
+)
+
+const (
+	// maxJobs bounds how many jobs the server remembers; the oldest
+	// finished ones are forgotten first.
+	maxJobs = 500
+	// maxRunningJobs bounds how many jobs run at once; the others wait,
+	// queued, for a slot.
+	maxRunningJobs = 4
+	// maxQueuedJobs bounds how many jobs wait for a slot, each holding its
+	// uploads in memory; more are refused until some start.
+	maxQueuedJobs = 32
+	// retryBusy is the Retry-After, in seconds, of requests refused because
+	// the queue is full.
+	retryBusy = "30"
+	// maxJobEvents bounds the events a job keeps for late subscribers; the
+	// oldest are dropped first.
+	maxJobEvents = 200
+	// keepAlive is how often an idle event stream sends a comment, so
+	// proxies do not time it out.
+	keepAlive = 15 * time.Second
+)
+
+// errBusy is returned by Server.start when the queue is full.
+var errBusy = errors.New("too many jobs are waiting to run, try again shortly")
+
+// JobStatus is the state of a job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Done reports whether the job finished, successfully or not.
+func (s JobStatus) Done() bool {
+	return s == JobSucceeded || s == JobFailed
+}
+
+// Job kinds besides journal.KindApply.
+const jobProcess = "process"
+
+// Types of job events.
+const (
+	EventStatus   = "status"   // the job was queued, started or finished
+	EventProgress = "progress" // a batch of transactions was created
+	EventRetry    = "retry"    // a YNAB request failed and is retried
+	EventError    = "error"    // a file or section failed
+)
+
+// JobEvent is something that happened while a job ran, streamed to the UI.
+type JobEvent struct {
+	Time     time.Time           `json:"time"`
+	Type     string              `json:"type"`
+	Message  string              `json:"message"`
+	Progress *executors.Progress `json:"progress,omitempty"`
+}
+
+// Job is work done in the background on behalf of a user: applying
+// statements to YNAB, or reconciling several with their accounts.
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     JobStatus  `json:"status"`
+	File       string     `json:"file"`
+	BudgetID   string     `json:"budget_id,omitempty"`
+	AccountID  string     `json:"account_id,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Created counts the transactions created, also when the job failed
+	// half-way.
+	Created int       `json:"created"`
+	Error   *APIError `json:"error,omitempty"`
+	// Result is what the job produced besides transactions, such as the
+	// plan of a reconciliation.
+	Result any `json:"result,omitempty"`
+	// Events are the most recent events of the job; listings leave them
+	// out.
+	Events []JobEvent `json:"events,omitempty"`
+
+	owner string
+	// dropped counts the events dropped to keep maxJobEvents.
+	dropped int
+	// changed is closed, and replaced, whenever the job changes.
+	changed chan struct{}
+}
+
+// jobs keeps the recent jobs of every user, in memory.
+type jobs struct {
+	mu    sync.Mutex
+	byID  map[string]*Job
+	order []string
+}
+
+func newJobs() *jobs {
+	return &jobs{byID: make(map[string]*Job)}
+}
+
+// newID returns a random, unguessable ID for jobs, plans and downloads.
+func newID() string {
+	raw := make([]byte, 16)
+	_, _ = rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// add remembers a job, forgetting the oldest finished one when full. It
+// returns errBusy, and forgets nothing, when maxQueuedJobs are already
+// queued or no job it remembers has finished.
+func (j *jobs) add(job *Job) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.queued() >= maxQueuedJobs {
+		return errBusy
+	}
+	if len(j.order) >= maxJobs {
+		i := slices.IndexFunc(j.order, func(id string) bool { return j.byID[id].Status.Done() })
+		if i < 0 {
+			return errBusy
+		}
+		delete(j.byID, j.order[i])
+		j.order = slices.Delete(j.order, i, i+1)
+	}
+	job.changed = make(chan struct{})
+	j.byID[job.ID] = job
+	j.order = append(j.order, job.ID)
+	return nil
+}
+
+// busy reports whether the queue is full, so a new job would be refused.
+func (j *jobs) busy() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.queued() >= maxQueuedJobs
+}
+
+// queued counts the jobs waiting for a slot. j.mu must be held.
+func (j *jobs) queued() int {
+	n := 0
+	for _, job := range j.byID {
+		if job.Status == JobQueued {
+			n++
+		}
+	}
+	return n
+}
+
+// update changes a job with fn and wakes up whoever watches it.
+func (j *jobs) update(id string, fn func(*Job)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.byID[id]
+	if !ok {
+		return // forgotten while running
+	}
+	fn(job)
+	if n := len(job.Events) - maxJobEvents; n > 0 {
+		job.Events = append([]JobEvent(nil), job.Events[n:]...)
+		job.dropped += n
+	}
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// get returns a job of owner.
+func (j *jobs) get(owner, id string) (Job, bool) {
+	job, _, ok := j.watch(owner, id)
+	return job, ok
+}
+
+// watch returns a job of owner and a channel closed when it next changes.
+func (j *jobs) watch(owner, id string) (Job, <-chan struct{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.byID[id]
+	if !ok || job.owner != owner {
+		return Job{}, nil, false
+	}
+	out := *job
+	out.Events = append([]JobEvent(nil), job.Events...)
+	return out, job.changed, true
+}
+
+// list returns the jobs of owner, newest first, without their events.
+func (j *jobs) list(owner string) []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := []Job{}
+	for i := len(j.order) - 1; i >= 0; i-- {
+		if job := j.byID[j.order[i]]; job.owner == owner {
+			out := *job
+			out.Events = nil
+			list = append(list, out)
+		}
+	}
+	return list
+}
+
+// task is what a running job reports through.
+type task struct {
+	jobs *jobs
+	id   string
+}
+
+// event records an event of the job.
+func (t *task) event(typ, message string, progress *executors.Progress) {
+	t.update(func(job *Job) {
+		job.Events = append(job.Events, JobEvent{Time: time.Now().UTC(), Type: typ, Message: message, Progress: progress})
+	})
+}
+
+// update changes the job.
+func (t *task) update(fn func(*Job)) {
+	t.jobs.update(t.id, fn)
+}
+
+// start runs fn as job in the background, once one of the maxRunningJobs
+// slots is free, and returns the job as queued, or errBusy when the queue
+// is full. The job fails with the error fn returns.
+func (s *Server) start(job *Job, fn func(*task) error) (Job, error) {
+	job.ID = newID()
+	job.Status = JobQueued
+	job.StartedAt = time.Now().UTC()
+	job.Events = []JobEvent{{Time: job.StartedAt, Type: EventStatus, Message: string(JobQueued)}}
+	if err := s.jobs.add(job); err != nil {
+		return Job{}, err
+	}
+	queued, _ := s.jobs.get(job.owner, job.ID)
+
+	t := &task{jobs: s.jobs, id: job.ID}
+	go func() {
+		s.slots <- struct{}{}
+		defer func() { <-s.slots }()
+
+		t.update(func(job *Job) { job.Status = JobRunning })
+		t.event(EventStatus, string(JobRunning), nil)
+		err := func() (err error) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					s.logger.Error("panic recovered", "panic", rec, "job", t.id)
+					err = fmt.Errorf("panic: %v", rec)
+				}
+			}()
+			return fn(t)
+		}()
+
+		var done Job
+		t.update(func(job *Job) {
+			now := time.Now().UTC()
+			job.FinishedAt = &now
+			job.Status = JobSucceeded
+			if err != nil {
+				_, apiErr := classify(err)
+				job.Status, job.Error = JobFailed, &apiErr
+			}
+			job.Events = append(job.Events, JobEvent{Time: now, Type: EventStatus, Message: string(job.Status)})
+			done = *job
+		})
+		s.logger.Info("job finished", "job", done.ID, "kind", done.Kind, "file", done.File, "status", done.Status, "created", done.Created)
+	}()
+	return queued, nil
+}
+
+// streamJob streams the events of a job of owner as Server-Sent Events, from
+// after the Last-Event-ID a reconnecting client sends, and ends the stream
+// with a "done" event holding the finished job. It reports false when there
+// is no such job.
+func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, owner, id string) bool {
+	job, changed, ok := s.jobs.watch(owner, id)
+	if !ok {
+		return false
+	}
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// events are numbered from the first of the job, dropped ones included
+	next := 0
+	if last, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = last + 1
+	}
+	timer := time.NewTimer(keepAlive)
+	defer timer.Stop()
+	for {
+		for i := max(next-job.dropped, 0); i < len(job.Events); i++ {
+			data, _ := json.Marshal(job.Events[i])
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", job.dropped+i, job.Events[i].Type, data)
+		}
+		next = job.dropped + len(job.Events)
+		done := job.Status.Done()
+		if done {
+			job.Events = nil
+			data, _ := json.Marshal(job)
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done {
+			return true
+		}
+
+		timer.Reset(keepAlive)
+		select {
+		case <-changed:
+		case <-timer.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return true
+		}
+		if job, changed, ok = s.jobs.watch(owner, id); !ok {
+			return true // forgotten meanwhile
+		}
+	}
+}
+
+// owner identifies whose a job is without keeping the token around: the
+// browser session when the request came with one, whose OAuth token changes
+// on every refresh, the bearer token otherwise.
+func (s *Server) owner(r *http.Request, token string) string {
+	if r.Header.Get("Authorization") == "" {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			return "session:" + sessionKey(c.Value)
+		}
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])
+}
+
+// scope is the owner of a request that may not be signed in: its session or
+// bearer token, shared by every anonymous client otherwise, who can only
+// reach what they created through its unguessable ID.
+func (s *Server) scope(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return s.owner(r, strings.TrimSpace(token))
+}
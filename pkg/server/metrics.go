@@ -0,0 +1,270 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram: Prometheus' defaults.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts observations per bucket, Prometheus style: each bucket
+// counts the observations up to its bound, the smaller ones included.
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if v <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// requestKey labels HTTP requests to the server.
+type requestKey struct {
+	route, method, code string
+}
+
+// ynabKey labels requests to YNAB.
+type ynabKey struct {
+	method, code string
+}
+
+// metrics counts what the server does since it started, served by /metrics
+// in the Prometheus text format. Labels never hold user data: routes are
+// the patterns requests matched, not their paths.
+type metrics struct {
+	mu            sync.Mutex
+	requests      map[requestKey]uint64
+	latency       map[string]*histogram // by route
+	parsed        map[string]uint64     // by format
+	parseFailures map[string]uint64     // by format
+	created       uint64
+	ynabRequests  map[ynabKey]uint64
+	ynabErrors    map[string]uint64 // by method
+	// rateLimit is the quota of the latest YNAB response of any user.
+	rateLimit ynab.RateLimit
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      make(map[requestKey]uint64),
+		latency:       make(map[string]*histogram),
+		parsed:        make(map[string]uint64),
+		parseFailures: make(map[string]uint64),
+		ynabRequests:  make(map[ynabKey]uint64),
+		ynabErrors:    make(map[string]uint64),
+	}
+}
+
+// observeRequest records a request the server answered.
+func (m *metrics) observeRequest(route, method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{route, method, strconv.Itoa(code)}]++
+	h, ok := m.latency[route]
+	if !ok {
+		h = &histogram{}
+		m.latency[route] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// observeParse records a statement parsed as format, err telling whether it
+// failed.
+func (m *metrics) observeParse(format string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parsed[format]++
+	if err != nil {
+		m.parseFailures[format]++
+	}
+}
+
+// addCreated records transactions created in YNAB.
+func (m *metrics) addCreated(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.created += uint64(n)
+}
+
+// observeYNAB records a request sent to YNAB; see ynab.RequestNotifier.
+func (m *metrics) observeYNAB(r ynab.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ynabRequests[ynabKey{r.Method, strconv.Itoa(r.Status)}]++
+	if r.Failed() {
+		m.ynabErrors[r.Method]++
+	}
+	if r.RateLimit.Known() {
+		m.rateLimit = r.RateLimit
+	}
+}
+
+// write writes the metrics, and the statistics of the download cache, in
+// the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer, cache cacheStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	header(w, "ynabu_http_requests_total", "counter", "HTTP requests answered, by route, method and status code.")
+	for _, k := range sortedKeys(m.requests, func(k requestKey) string { return k.route + " " + k.method + " " + k.code }) {
+		sample(w, "ynabu_http_requests_total", labels("route", k.route, "method", k.method, "code", k.code), float64(m.requests[k]))
+	}
+
+	header(w, "ynabu_http_request_duration_seconds", "histogram", "Time to answer HTTP requests, by route. Event streams last as long as their job.")
+	for _, route := range sortedKeys(m.latency, func(k string) string { return k }) {
+		h := m.latency[route]
+		for i, bound := range latencyBuckets {
+			sample(w, "ynabu_http_request_duration_seconds_bucket", labels("route", route, "le", strconv.FormatFloat(bound, 'g', -1, 64)), float64(h.buckets[i]))
+		}
+		sample(w, "ynabu_http_request_duration_seconds_bucket", labels("route", route, "le", "+Inf"), float64(h.count))
+		sample(w, "ynabu_http_request_duration_seconds_sum", labels("route", route), h.sum)
+		sample(w, "ynabu_http_request_duration_seconds_count", labels("route", route), float64(h.count))
+	}
+
+	header(w, "ynabu_statements_parsed_total", "counter", "Statements parsed, by format, failed ones included.")
+	for _, format := range sortedKeys(m.parsed, func(k string) string { return k }) {
+		sample(w, "ynabu_statements_parsed_total", labels("format", format), float64(m.parsed[format]))
+	}
+	header(w, "ynabu_statement_parse_failures_total", "counter", "Statements that failed to parse, by format.")
+	for _, format := range sortedKeys(m.parseFailures, func(k string) string { return k }) {
+		sample(w, "ynabu_statement_parse_failures_total", labels("format", format), float64(m.parseFailures[format]))
+	}
+
+	header(w, "ynabu_transactions_created_total", "counter", "Transactions created in YNAB.")
+	sample(w, "ynabu_transactions_created_total", "", float64(m.created))
+
+	header(w, "ynabu_ynab_requests_total", "counter", "Requests sent to the YNAB API, retries included, by method and status code (0 when no response came).")
+	for _, k := range sortedKeys(m.ynabRequests, func(k ynabKey) string { return k.method + " " + k.code }) {
+		sample(w, "ynabu_ynab_requests_total", labels("method", k.method, "code", k.code), float64(m.ynabRequests[k]))
+	}
+	header(w, "ynabu_ynab_request_errors_total", "counter", "Requests to the YNAB API that failed or got an error status, by method.")
+	for _, method := range sortedKeys(m.ynabErrors, func(k string) string { return k }) {
+		sample(w, "ynabu_ynab_request_errors_total", labels("method", method), float64(m.ynabErrors[method]))
+	}
+	if m.rateLimit.Known() && !m.rateLimit.Expired(time.Now()) {
+		header(w, "ynabu_ynab_rate_limit_remaining", "gauge", "Requests left in the YNAB quota of the latest response, whichever user it was for.")
+		sample(w, "ynabu_ynab_rate_limit_remaining", "", float64(m.rateLimit.Remaining()))
+	}
+
+	header(w, "ynabu_download_cache_entries", "gauge", "CSVs kept for download.")
+	sample(w, "ynabu_download_cache_entries", "", float64(cache.Entries))
+	header(w, "ynabu_download_cache_bytes", "gauge", "Memory taken by the CSVs kept for download.")
+	sample(w, "ynabu_download_cache_bytes", "", float64(cache.Bytes))
+	header(w, "ynabu_download_cache_hits_total", "counter", "CSV downloads served from the cache.")
+	sample(w, "ynabu_download_cache_hits_total", "", float64(cache.Hits))
+	header(w, "ynabu_download_cache_misses_total", "counter", "CSV downloads not found, expired or someone else's.")
+	sample(w, "ynabu_download_cache_misses_total", "", float64(cache.Misses))
+	header(w, "ynabu_download_cache_evictions_total", "counter", "CSVs dropped to make room for newer ones.")
+	sample(w, "ynabu_download_cache_evictions_total", "", float64(cache.Evictions))
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(w io.Writer, name, labels string, v float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// labelValue escapes label values.
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats name/value pairs as {name="value",...}.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, pairs[i], labelValue.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// sortedKeys returns the keys of m in the order of key, so every scrape
+// lists the series alike.
+func sortedKeys[K comparable, V any](m map[K]V, key func(K) string) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int { return strings.Compare(key(a), key(b)) })
+	return keys
+}
+
+// route is the label of the pattern a request matched, without its method:
+// the path is left out, since it may hold IDs.
+func route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	_, path, ok := strings.Cut(r.Pattern, " ")
+	if !ok {
+		return r.Pattern
+	}
+	return path
+}
+
+// statusRecorder remembers the status code a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps event streams working through the recorder.
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// method is the label of the method of a request; unknown methods share
+// one, so clients cannot add series at will.
+func method(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return r.Method
+	}
+	return "other"
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/parser"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+	"github.com/yurifrl/ynabu/pkg/ynab/fake"
+)
+
+func TestServerHealthAndReadiness(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		res, err := get(t, ts.URL+path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status %d", path, res.StatusCode)
+		}
+	}
+
+	state := t.TempDir()
+	broken := httptest.NewServer(New(&config.Config{SessionKey: "key", StateDir: state}, log.New(os.Stderr), WithTemplates("../../templates/*.html")))
+	t.Cleanup(broken.Close)
+	// The session directory goes away, say with the volume it was on.
+	if err := os.RemoveAll(filepath.Join(state, "sessions")); err != nil {
+		t.Fatal(err)
+	}
+	res, err := get(t, broken.URL+"/readyz", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusServiceUnavailable || out.Checks["templates"] != "ok" || !strings.Contains(out.Checks["sessions"], "no such file") {
+		t.Errorf("expected the missing session directory to be reported, got %d %+v", res.StatusCode, out)
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	m := newMetrics()
+	m.observeRequest("/api/process", http.MethodPost, http.StatusAccepted, 30*time.Millisecond)
+	m.observeParse("itau_extrato_txt", nil)
+	m.observeParse("itau_extrato_txt", errors.New("bad line"))
+	m.observeYNAB(ynab.Request{Method: http.MethodGet, Status: http.StatusTooManyRequests, RateLimit: ynab.RateLimit{Used: 200, Limit: 200}})
+	m.addCreated(3)
+
+	var b strings.Builder
+	m.write(&b, cacheStats{Entries: 1, Bytes: 42})
+	for _, want := range []string{
+		"# TYPE ynabu_http_requests_total counter\n",
+		`ynabu_http_requests_total{route="/api/process",method="POST",code="202"} 1` + "\n",
+		`ynabu_http_request_duration_seconds_bucket{route="/api/process",le="0.025"} 0` + "\n",
+		`ynabu_http_request_duration_seconds_bucket{route="/api/process",le="0.05"} 1` + "\n",
+		`ynabu_http_request_duration_seconds_bucket{route="/api/process",le="+Inf"} 1` + "\n",
+		`ynabu_statements_parsed_total{format="itau_extrato_txt"} 2` + "\n",
+		`ynabu_statement_parse_failures_total{format="itau_extrato_txt"} 1` + "\n",
+		"ynabu_transactions_created_total 3\n",
+		`ynabu_ynab_requests_total{method="GET",code="429"} 1` + "\n",
+		`ynabu_ynab_request_errors_total{method="GET"} 1` + "\n",
+		"ynabu_ynab_rate_limit_remaining 0\n",
+		"ynabu_download_cache_bytes 42\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+
+	if got := labels("file", "a\"b\\c\nd"); got != `{file="a\"b\\c\nd"}` {
+		t.Errorf("label values not escaped: %s", got)
+	}
+}
+
+// TestServerMetrics processes and applies the extrato through a YNAB client
+// talking HTTP, so its requests reach the metrics.
+func TestServerMetrics(t *testing.T) {
+	client := fake.New()
+	client.AddBudget("budget-1", "Family")
+	client.AddAccount("budget-1", "account-1", "Itaú Conta Corrente")
+	client.SetRateLimit(0, 200)
+	ynabTS := httptest.NewServer(fake.NewHandler(client, ""))
+	t.Cleanup(ynabTS.Close)
+
+	srv := New(&config.Config{UseCustomID: true}, log.New(os.Stderr),
+		WithTemplates("../../templates/*.html"),
+		WithClientFactory(func(token string) ynab.Client { return ynab.NewWithBaseURL(token, ynabTS.URL+"/v1") }),
+	)
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	out := upload(t, ts.URL, map[string]string{"budget_id": "budget-1", "account_id": "account-1"})
+	if status, job := apply(t, ts.URL, out["plan_id"].(string)); status != http.StatusAccepted || job.Created != 3 {
+		t.Fatalf("apply: %d %+v", status, job)
+	}
+
+	res, err := get(t, ts.URL+"/metrics", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	for _, want := range []string{
+		`ynabu_http_requests_total{route="/api/process",method="POST",code="202"} 1`,
+		`ynabu_http_requests_total{route="/api/jobs/{id}/events",method="GET",code="200"} 2`,
+		`ynabu_statements_parsed_total{format="` + parser.DetectFormat("extrato.txt") + `"} 1`,
+		"ynabu_transactions_created_total 3",
+		`ynabu_ynab_requests_total{method="GET",code="200"}`,
+		`ynabu_ynab_requests_total{method="POST",code="201"}`,
+		"ynabu_ynab_rate_limit_remaining ",
+		"ynabu_download_cache_entries 1",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "ynabu_ynab_request_errors_total{") {
+		t.Errorf("no YNAB request failed, got:\n%s", body)
+	}
+}
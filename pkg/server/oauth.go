@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+)
+
+// stateCookie carries the OAuth state parameter between /auth/login and
+// /auth/callback, tying the callback to the browser that started the login.
+const stateCookie = "ynabu_oauth_state"
+
+// newOAuth returns the OAuth client of cfg, or nil when it is not enabled.
+func newOAuth(cfg config.OAuthConfig) *oauth2.Config {
+	if !cfg.Enabled() {
+		return nil
+	}
+	base := strings.TrimSuffix(cfg.BaseURL, "/")
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   base + "/oauth/authorize",
+			TokenURL:  base + "/oauth/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// handleLogin sends the browser to YNAB to authorize ynabu.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oauth == nil {
+		s.respondError(w, r, http.StatusNotFound, "OAuth login is not configured", nil)
+		return
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, "failed to start login", err)
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(raw)
+
+	c := s.cookie(r, stateCookie, state, 600)
+	c.Path = "/auth/"
+	http.SetCookie(w, c)
+	http.Redirect(w, r, s.oauth.AuthCodeURL(state), http.StatusFound)
+}
+
+// handleCallback finishes the login YNAB redirected back from: the code is
+// exchanged for tokens, which are kept in a new session.
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oauth == nil {
+		s.respondError(w, r, http.StatusNotFound, "OAuth login is not configured", nil)
+		return
+	}
+	q := r.URL.Query()
+	c, err := r.Cookie(stateCookie)
+	if err != nil || c.Value == "" || c.Value != q.Get("state") {
+		s.respondError(w, r, http.StatusBadRequest, "invalid OAuth state, start the login again", err)
+		return
+	}
+	clear := s.cookie(r, stateCookie, "", -1)
+	clear.Path = "/auth/"
+	http.SetCookie(w, clear)
+
+	if e := q.Get("error"); e != "" {
+		s.respondError(w, r, http.StatusUnauthorized, "YNAB login failed: "+e, nil)
+		return
+	}
+	tok, err := s.oauth.Exchange(r.Context(), q.Get("code"))
+	if err != nil {
+		s.respondError(w, r, http.StatusBadGateway, "failed to exchange the OAuth code", err)
+		return
+	}
+
+	err = s.startSession(w, r, session{Token: tok.AccessToken, RefreshToken: tok.RefreshToken, TokenExpiry: tok.Expiry})
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, "failed to create session", err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// refresh renews the OAuth token of a session when it is about to expire and
+// saves the session with the new tokens.
+func (s *Server) refresh(r *http.Request, id string, sess *session) error {
+	if s.oauth == nil {
+		return nil // OAuth was turned off; use the token while it lasts
+	}
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	// Another request may have refreshed the session meanwhile.
+	if current, err := s.sessions.get(id); err == nil {
+		*sess = *current
+	}
+	old := &oauth2.Token{AccessToken: sess.Token, RefreshToken: sess.RefreshToken, Expiry: sess.TokenExpiry}
+	tok, err := s.oauth.TokenSource(r.Context(), old).Token()
+	if err != nil {
+		return err
+	}
+	if tok.AccessToken == sess.Token {
+		return nil
+	}
+	sess.Token, sess.TokenExpiry = tok.AccessToken, tok.Expiry
+	if tok.RefreshToken != "" {
+		sess.RefreshToken = tok.RefreshToken
+	}
+	s.logger.Debug("refreshed OAuth token", "expiry", tok.Expiry)
+	return s.sessions.save(id, *sess)
+}
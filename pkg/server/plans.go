@@ -0,0 +1,93 @@
+package server
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yurifrl/ynabu/pkg/executors"
+)
+
+const (
+	// planTTL is how long a plan previewed by /api/process can be applied.
+	planTTL = 30 * time.Minute
+	// maxPlans bounds how many plans the server keeps; the oldest are
+	// forgotten first.
+	maxPlans = 500
+)
+
+// plan is what /api/process showed the user: one saved plan step per
+// reconciled section, applied as is by /api/apply.
+type plan struct {
+	owner   string
+	expires time.Time
+	steps   []*executors.PlanStep
+}
+
+// plans keeps previewed plans in memory until they are applied or expire.
+type plans struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	byID  map[string]*plan
+	order []string
+}
+
+func newPlans() *plans {
+	return &plans{now: time.Now, byID: make(map[string]*plan)}
+}
+
+// add stores the steps of owner and returns the plan ID and when it
+// expires.
+func (p *plans) add(owner string, steps []*executors.PlanStep) (string, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire()
+	for len(p.byID) >= maxPlans {
+		delete(p.byID, p.order[0])
+		p.order = p.order[1:]
+	}
+	id := newID()
+	expires := p.now().Add(planTTL)
+	p.byID[id] = &plan{owner: owner, expires: expires, steps: steps}
+	p.order = append(p.order, id)
+	return id, expires
+}
+
+// take removes and returns a plan of owner that has not expired, so it is
+// applied at most once.
+func (p *plans) take(owner, id string) (*plan, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire()
+	pl, ok := p.byID[id]
+	if !ok || pl.owner != owner || !p.now().Before(pl.expires) {
+		return nil, false
+	}
+	delete(p.byID, id)
+	return pl, true
+}
+
+// restore puts back a plan taken with take that could not be applied, so it
+// can be applied again until it expires as it would have.
+func (p *plans) restore(id string, pl *plan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !slices.Contains(p.order, id) {
+		// expire already dropped its place in line.
+		p.order = append(p.order, id)
+	}
+	p.byID[id] = pl
+}
+
+// expire forgets expired plans. Plans expire in the order they were added.
+func (p *plans) expire() {
+	now := p.now()
+	for len(p.order) > 0 {
+		pl, ok := p.byID[p.order[0]]
+		if ok && now.Before(pl.expires) {
+			return
+		}
+		delete(p.byID, p.order[0])
+		p.order = p.order[1:]
+	}
+}
@@ -2,21 +2,24 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/yurifrl/ynabu/pkg/csv"
 
 	"github.com/charmbracelet/log"
+	"golang.org/x/oauth2"
+
 	"github.com/yurifrl/ynabu/pkg/config"
 	"github.com/yurifrl/ynabu/pkg/executors"
+	"github.com/yurifrl/ynabu/pkg/journal"
 	"github.com/yurifrl/ynabu/pkg/models"
 	"github.com/yurifrl/ynabu/pkg/parser"
 	"github.com/yurifrl/ynabu/pkg/ynab"
@@ -24,30 +27,111 @@ import (
 
 // Server handles HTTP requests for YNAB file processing
 type Server struct {
-	config       *config.Config
-	logger       *log.Logger
-	mux          *http.ServeMux
-	template     *template.Template
-	parser       *parser.Parser
-	transactions sync.Map
+	config    *config.Config
+	logger    *log.Logger
+	mux       *http.ServeMux
+	template  *template.Template
+	parser    *parser.Parser
+	newClient func(token string) ynab.Client
+	sessions  *sessions
+	jobs      *jobs
+	// slots holds a token per running job, see start.
+	slots     chan struct{}
+	plans     *plans
+	downloads *downloads
+	metrics   *metrics
+	oauth     *oauth2.Config
+	refreshMu sync.Mutex
+}
+
+// Option customises a Server built by New.
+type Option func(*options)
+
+type options struct {
+	templates string
+	newClient func(token string) ynab.Client
+}
+
+// WithTemplates sets the glob the HTML templates are loaded from
+// (default "templates/*.html", relative to the working directory).
+func WithTemplates(glob string) Option {
+	return func(o *options) { o.templates = glob }
+}
+
+// WithClientFactory replaces how YNAB clients are built from the user's
+// token, e.g. with an in-memory fake in tests.
+func WithClientFactory(f func(token string) ynab.Client) Option {
+	return func(o *options) { o.newClient = f }
 }
 
 // New creates a new HTTP server
-func New(config *config.Config, logger *log.Logger) *Server {
-	tmpl := template.Must(template.ParseGlob("templates/*.html"))
-	return &Server{
-		config:   config,
-		logger:   logger,
-		mux:      http.NewServeMux(),
-		template: tmpl,
-		parser:   parser.New(logger),
+func New(config *config.Config, logger *log.Logger, opts ...Option) *Server {
+	o := options{
+		templates: "templates/*.html",
+		// No transaction cache here, unlike the CLI: a server sees many
+		// tokens, OAuth ones change on every refresh so their caches would
+		// pile up, and concurrent requests of one user would race on its
+		// files.
+		newClient: func(token string) ynab.Client { return ynab.New(token) },
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tmpl := template.Must(template.ParseGlob(o.templates))
+	if config.SessionKey == "" {
+		logger.Warn("no session_key configured, sessions end when the server restarts")
+	}
+	// Without a key sessions cannot outlive the process, so there is no
+	// point in storing them on disk.
+	sessionDir := ""
+	if config.SessionKey != "" && config.StateDir != "" {
+		sessionDir = filepath.Join(config.StateDir, "sessions")
+	}
+	sess, err := newSessions(config.SessionKey, sessionDir)
+	if err != nil {
+		panic(fmt.Sprintf("failed to set up sessions: %v", err))
+	}
+	s := &Server{
+		config:    config,
+		logger:    logger,
+		mux:       http.NewServeMux(),
+		template:  tmpl,
+		parser:    parser.New(logger),
+		sessions:  sess,
+		jobs:      newJobs(),
+		plans:     newPlans(),
+		downloads: newDownloads(maxDownloadBytes, maxOwnerDownloadBytes, downloadTTL),
+		metrics:   newMetrics(),
+		slots:     make(chan struct{}, maxRunningJobs),
+		oauth:     newOAuth(config.OAuth),
+	}
+	s.newClient = func(token string) ynab.Client {
+		client := o.newClient(token)
+		if n, ok := client.(ynab.RequestNotifier); ok {
+			n.OnRequest(s.metrics.observeYNAB)
+		}
+		return client
 	}
+	s.setupRoutes()
+	return s
 }
 
 // Start starts the HTTP server
 func (s *Server) Start(addr string) error {
-	s.setupRoutes()
-	return http.ListenAndServe(addr, s.mux)
+	return http.ListenAndServe(addr, s)
+}
+
+// ServeHTTP makes the server usable as a plain http.Handler. It records
+// every request in the metrics.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	s.mux.ServeHTTP(rec, r)
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	s.metrics.observeRequest(route(r), method(r), rec.code, time.Since(start))
 }
 
 func (s *Server) setupRoutes() {
@@ -58,9 +142,20 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/process", s.withLogging(s.handleProcess))
 	s.mux.HandleFunc("/api/apply", s.withLogging(s.handleApply))
 	s.mux.HandleFunc("/api/files/", s.withLogging(s.handleFiles))
+	s.mux.HandleFunc("GET /api/jobs/{id}", s.withLogging(s.handleJob))
+	s.mux.HandleFunc("GET /api/jobs/{id}/events", s.withLogging(s.handleJobEvents))
 	s.mux.HandleFunc("/api/budgets", s.withLogging(s.handleBudgets))
 	s.mux.HandleFunc("/api/budgets/", s.withLogging(s.handleBudgetAccounts))
+	s.mux.HandleFunc("/api/session", s.withLogging(s.handleSession))
+	s.mux.HandleFunc("/auth/login", s.withLogging(s.handleLogin))
+	s.mux.HandleFunc("/auth/callback", s.withLogging(s.handleCallback))
+
+	// operations
+	s.mux.HandleFunc("GET /healthz", s.withLogging(s.handleHealthz))
+	s.mux.HandleFunc("GET /readyz", s.withLogging(s.handleReadyz))
+	s.mux.HandleFunc("GET /metrics", s.withLogging(s.handleMetrics))
 
+	s.setupV1Routes()
 }
 
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
@@ -76,14 +171,14 @@ func (s *Server) handleBudgets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		s.respondError(w, r, http.StatusBadRequest, "token required", nil)
+	token, err := s.token(r)
+	if err != nil {
+		s.respondError(w, r, http.StatusUnauthorized, err.Error(), nil)
 		return
 	}
 
-	ynabClient := ynab.New(token)
-	budgetsResponse, err := ynabClient.Budget().GetBudgets()
+	ynabClient := s.newClient(token)
+	budgetsResponse, err := ynabClient.GetBudgets()
 	if err != nil {
 		s.respondError(w, r, http.StatusBadGateway, "failed to fetch budgets", err)
 		return
@@ -121,25 +216,24 @@ func (s *Server) handleBudgetAccounts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		s.respondError(w, r, http.StatusBadRequest, "token required", nil)
+	token, err := s.token(r)
+	if err != nil {
+		s.respondError(w, r, http.StatusUnauthorized, err.Error(), nil)
 		return
 	}
 
-	ynabClient := ynab.New(token)
-	accountsResponse, err := ynabClient.Account().GetAccounts(budgetID, nil)
+	ynabClient := s.newClient(token)
+	accountsResponse, err := ynabClient.GetAccounts(budgetID)
 	if err != nil {
 		s.respondError(w, r, http.StatusBadGateway, "failed to fetch accounts", err)
 		return
 	}
 
-	// Extract accounts array from SearchResultSnapshot
+	// Convert the accounts slice to interface{} slice for JSON serialization
 	var accounts []interface{}
-	if accountsResponse != nil && accountsResponse.Accounts != nil {
-		// Convert the accounts slice to interface{} slice for JSON serialization
-		accounts = make([]interface{}, len(accountsResponse.Accounts))
-		for i, account := range accountsResponse.Accounts {
+	if accountsResponse != nil {
+		accounts = make([]interface{}, len(accountsResponse))
+		for i, account := range accountsResponse {
 			accounts[i] = account
 		}
 	}
@@ -156,179 +250,333 @@ func (s *Server) handleBudgetAccounts(w http.ResponseWriter, r *http.Request) {
 }
 
 // ---------------- consolidated handler ----------------
+
+// handleProcess parses every uploaded statement and, when signed in, starts
+// a job reconciling each section that has an account. The job's result is
+// one combined plan, see processResult.
 func (s *Server) handleProcess(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
 		return
 	}
 
-	// read file
-	file, header, err := r.FormFile("statement")
-	if err != nil {
-		s.respondError(w, r, http.StatusBadRequest, "failed to read file", err)
-		return
-	}
-	defer file.Close()
-	data, err := io.ReadAll(file)
+	files, err := s.readBatch(w, r)
 	if err != nil {
-		s.respondError(w, r, http.StatusInternalServerError, "failed to read file", err)
+		s.respondError(w, r, http.StatusBadRequest, "failed to read files", err)
 		return
 	}
 
-	// parse local transactions once
-	localTxs, err := s.parser.ProcessBytes(data, header.Filename)
+	// reconcile the sections with an account when signed in; the budget
+	// falls back to the configured one, then to last-used
+	token, _ := s.token(r)
+	budgetID := r.FormValue("budget_id")
+	owner := s.scope(r)
+
+	job, err := s.start(&Job{Kind: jobProcess, File: fileNames(files), owner: owner}, func(t *task) error {
+		result := s.processBatch(t, owner, token, budgetID, files)
+		t.update(func(job *Job) { job.Result = result })
+		return nil
+	})
 	if err != nil {
-		s.respondError(w, r, http.StatusBadRequest, "failed to process file", err)
+		s.respondBusy(w, r, err)
 		return
 	}
+	s.writeJob(w, job)
+}
 
-	// build csv list for html table
-	sort.Slice(localTxs, func(i, j int) bool { return localTxs[i].Date() < localTxs[j].Date() })
-	filename := strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)) + "-ynabu.csv"
-	s.transactions.Store(filename, localTxs)
-
-	txs := make([]Transaction, len(localTxs))
-	for i, t := range localTxs {
-		txs[i] = Transaction{Date: t.Date(), Payee: t.Payee(), Memo: t.Memo(), Amount: t.Amount()}
-	}
-
-	// check if reconciliation requested (token + budget + account provided)
-	token := r.FormValue("token")
-	budgetID := r.FormValue("budget_id")
-	accountID := r.FormValue("account_id")
-
-	var lines []string
-	var toAdd, inSync int
-
-	if token != "" && budgetID != "" && accountID != "" {
-		ynabClient := ynab.New(token)
-		remoteTxs, err := ynabClient.Transaction().GetTransactionsByAccount(budgetID, accountID, nil)
-		if err != nil {
-			s.respondError(w, r, http.StatusBadGateway, "failed to fetch remote transactions", err)
-			return
+// processBatch builds the combined plan of an upload; see handleProcess.
+func (s *Server) processBatch(t *task, owner, token, budgetID string, files []*batchFile) map[string]any {
+	var total executors.Summary
+	var steps []*executors.PlanStep
+	var exec *executors.Executor
+	if token != "" {
+		client := s.newClient(token)
+		s.reportRetries(t, client)
+		exec = executors.New(s.logger, s.config, client)
+	}
+	views := make([]FileView, len(files))
+	for i, bf := range files {
+		view := FileView{Index: i, Name: bf.up.Name, Transactions: []Transaction{}, Sections: []SectionView{}}
+		if bf.err != nil {
+			view.Error = bf.err.Error()
+			views[i] = view
+			t.event(EventError, fmt.Sprintf("%s: %v", bf.up.Name, bf.err), nil)
+			continue
 		}
-		report := executors.BuildReport(localTxs, remoteTxs, s.config.UseCustomID)
-		lines = make([]string, 0, len(report.Items))
-		for _, entry := range report.Items {
-			prefix := "="
-			if entry.Status == executors.ToAdd {
-				prefix = "+"
+		view.Format = bf.up.format
+		view.Download = s.storeCSV(owner, bf.up.Name, bf.local)
+		view.Transactions = transactionViews(bf.local)
+
+		for _, sec := range bf.sections {
+			sv := SectionView{Card: sec.Card, Key: sec.Key, Field: sectionField(i, sec.Card), AccountID: sec.Account, Transactions: transactionViews(sec.local)}
+			if exec != nil && sec.Account != "" {
+				t.event(EventStatus, "reconciling "+sectionLabel(bf, sec), nil)
+				report, err := exec.Plan(&models.Statement{
+					Source:  bf.up.Source,
+					Format:  bf.up.format,
+					Budget:  budgetID,
+					Account: sec.Account,
+					Filter:  sec.filter(bf.sections),
+				})
+				var step *executors.PlanStep
+				if err == nil {
+					step, err = report.Step()
+				}
+				if err != nil {
+					sv.Error = err.Error()
+					t.event(EventError, fmt.Sprintf("%s: %v", sectionLabel(bf, sec), err), nil)
+				} else {
+					report.Cards = sec.Card
+					plan := report.View()
+					sv.Plan = &plan
+					steps = append(steps, step)
+					total.Total += plan.Summary.Total
+					total.InSync += plan.Summary.InSync
+					total.ToAdd += plan.Summary.ToAdd
+				}
 			}
-			line := fmt.Sprintf("%s %s | %-30s | R$ %.2f | %s", prefix, entry.Local.Date(), entry.Local.Payee(), entry.Local.Amount(), entry.Local.ID())
-			lines = append(lines, line)
+			view.Sections = append(view.Sections, sv)
 		}
-		toAdd = report.MissingCount()
-		inSync = report.InSyncCount()
-		s.logger.Info("reconciliation complete", "file", header.Filename, "to_add", toAdd, "in_sync", inSync)
+		views[i] = view
 	}
+	s.logger.Info("reconciliation complete", "files", len(files), "to_add", total.ToAdd, "in_sync", total.InSync)
 
-	if err := s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"status":  "success",
-		"file":    filename,
-		"data":    txs,
-		"lines":   lines,
-		"to_add":  toAdd,
-		"in_sync": inSync,
-	}); err != nil {
-		s.logger.Warn("failed to write json response", "err", err)
+	out := map[string]any{
+		"files":   views,
+		"to_add":  total.ToAdd,
+		"in_sync": total.InSync,
+	}
+	// keep what was shown so /api/apply applies exactly that
+	if len(steps) > 0 {
+		id, expires := s.plans.add(owner, steps)
+		out["plan_id"], out["expires_at"] = id, expires
+	}
+	return out
+}
+
+// sectionLabel names a section in job events.
+func sectionLabel(bf *batchFile, sec *batchSection) string {
+	if sec.Card == "" {
+		return bf.up.Name
+	}
+	return bf.up.Name + " card " + sec.Card
+}
+
+// fileNames lists the uploaded files for a job.
+func fileNames(files []*batchFile) string {
+	names := make([]string, len(files))
+	for i, bf := range files {
+		names[i] = bf.up.Name
 	}
+	return strings.Join(names, ", ")
 }
 
 // ---------------- file download handler ----------------
 
 // Transaction represents a simplified transaction for JSON responses.
 type Transaction struct {
+	ID     string  `json:"id,omitempty"`
 	Date   string  `json:"date"`
 	Payee  string  `json:"payee"`
 	Memo   string  `json:"memo"`
 	Amount float64 `json:"amount"`
+	Line   int     `json:"line,omitempty"`
 }
 
 // handleFiles serves the generated CSV for a previously processed statement.
 // ---------------- apply (plan + create) handler ----------------
+
+// handleApply starts a job applying a plan previewed by /api/process: its
+// "plan_id", minus the entries listed in "exclude" (the IDs of the plan
+// entries the user unchecked). The job fails with stale_plan, applying
+// nothing, when any account changed since the preview; otherwise it applies
+// the sections in turn, stopping at the first failed one, since later ones
+// would likely fail the same way. A plan failing for another reason before
+// anything changed can be applied again.
 func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
 		return
 	}
-	// TODO: Work in menory instead of temp file
-	file, header, err := r.FormFile("statement")
+	token, err := s.token(r)
 	if err != nil {
-		s.respondError(w, r, http.StatusBadRequest, "statement file required", err)
+		s.respondError(w, r, http.StatusUnauthorized, err.Error(), nil)
 		return
 	}
-	defer file.Close()
-	data, _ := io.ReadAll(file)
-
-	budgetID := r.FormValue("budget_id")
-	accountID := r.FormValue("account_id")
-	if budgetID == "" {
-		s.respondError(w, r, http.StatusBadRequest, "budget_id required", nil)
+	id := r.FormValue("plan_id")
+	if id == "" {
+		s.respondError(w, r, http.StatusBadRequest, "plan_id required", nil)
 		return
 	}
-	if accountID == "" {
-		s.respondError(w, r, http.StatusBadRequest, "account_id required", nil)
+	// Refuse before taking the plan, so it can be applied once the queue
+	// drains.
+	if s.jobs.busy() {
+		s.respondBusy(w, r, errBusy)
 		return
 	}
-
-	// save temp file for executor to read
-	tmp := filepath.Join(os.TempDir(), header.Filename)
-	if err := os.WriteFile(tmp, data, 0600); err != nil {
-		s.respondError(w, r, http.StatusInternalServerError, "failed to write temp file", err)
+	pl, ok := s.plans.take(s.owner(r, token), id)
+	if !ok {
+		s.respondError(w, r, http.StatusNotFound, "plan not found or expired, process the statements again", nil)
 		return
 	}
 
-	stmt := &models.Statement{FilePath: tmp, BudgetID: budgetID, AccountID: accountID}
-
-	token := r.FormValue("token")
-	if token == "" {
-		s.respondError(w, r, http.StatusBadRequest, "token required", nil)
+	exclude := r.Form["exclude"]
+	pending := make([]*executors.PlanStep, 0, len(pl.steps))
+	files := make([]string, 0, len(pl.steps))
+	for _, step := range pl.steps {
+		step = step.Without(exclude)
+		if len(step.Changes) == 0 {
+			continue
+		}
+		pending = append(pending, step)
+		files = append(files, step.File)
+	}
+	job, err := s.start(&Job{Kind: string(journal.KindApply), File: strings.Join(files, ", "), owner: s.scope(r)}, func(t *task) error {
+		applying := false
+		err := s.runApply(t, token, func(exec *executors.Executor) error {
+			return exec.ApplySteps(pending, func(step *executors.PlanStep) {
+				applying = true
+				t.event(EventStatus, "applying "+step.File, nil)
+			})
+		})
+		// Nothing was applied: keep the plan unless it is stale.
+		if err != nil && !applying && !errors.Is(err, executors.ErrStalePlan) {
+			s.plans.restore(id, pl)
+		}
+		return err
+	})
+	if err != nil {
+		s.plans.restore(id, pl)
+		s.respondBusy(w, r, err)
 		return
 	}
+	s.writeJob(w, job)
+}
 
-	ynabCli := ynab.New(token)
-	exec := executors.New(s.logger, s.config, ynabCli)
-
-	if err := exec.Apply(stmt); err != nil {
-		s.respondError(w, r, http.StatusBadGateway, "apply failed", err)
+// handleJob returns a job of the user, for polling.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(s.scope(r), r.PathValue("id"))
+	if !ok {
+		s.respondError(w, r, http.StatusNotFound, "job not found", nil)
 		return
 	}
+	if err := s.writeJSON(w, http.StatusOK, job); err != nil {
+		s.logger.Warn("failed to write json response", "err", err)
+	}
+}
 
-	if err := s.writeJSON(w, http.StatusOK, map[string]any{"status": "applied"}); err != nil {
+// handleJobEvents streams the progress of a job of the user, see streamJob.
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.streamJob(w, r, s.scope(r), r.PathValue("id")) {
+		s.respondError(w, r, http.StatusNotFound, "job not found", nil)
+	}
+}
+
+// respondBusy answers a request whose job could not start, the queue being
+// full, asking the client to retry later.
+func (s *Server) respondBusy(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Retry-After", retryBusy)
+	s.respondError(w, r, http.StatusServiceUnavailable, err.Error(), nil)
+}
+
+// writeJob answers a request that started a job: 202 with the job and where
+// to follow it.
+func (s *Server) writeJob(w http.ResponseWriter, job Job) {
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	if err := s.writeJSON(w, http.StatusAccepted, map[string]any{"status": "started", "job": job}); err != nil {
 		s.logger.Warn("failed to write json response", "err", err)
 	}
 }
 
+// runApply runs apply with an executor journaling into the job of t, to
+// which it adds the transactions created and reports progress and retries.
+func (s *Server) runApply(t *task, token string, apply func(*executors.Executor) error) error {
+	run := &journal.Run{ID: t.id, Kind: journal.KindApply, StartedAt: time.Now().UTC()}
+	client := s.newClient(token)
+	s.reportRetries(t, client)
+	exec := executors.New(s.logger, s.config, client)
+	exec.Journal(run)
+	exec.OnProgress(func(p executors.Progress) {
+		t.event(EventProgress, fmt.Sprintf("%s: created %d of %d", p.File, p.Created, p.Total), &p)
+	})
+	err := apply(exec)
+
+	created := run.Count(string(executors.ActionCreate))
+	s.metrics.addCreated(created)
+	t.update(func(job *Job) {
+		job.Created += created
+		if len(run.Records) > 0 && job.AccountID == "" {
+			job.BudgetID, job.AccountID = run.Records[0].BudgetID, run.Records[0].AccountID
+		}
+	})
+	if err != nil {
+		t.event(EventError, err.Error(), nil)
+	}
+	return err
+}
+
+// reportRetries makes client report its retries as events of t, when it can.
+func (s *Server) reportRetries(t *task, client ynab.Client) {
+	if n, ok := client.(ynab.RetryNotifier); ok {
+		n.OnRetry(func(rt ynab.Retry) {
+			reason := http.StatusText(rt.Status)
+			if rt.Err != nil {
+				reason = rt.Err.Error()
+			}
+			t.event(EventRetry, fmt.Sprintf("YNAB request failed (%s), retry %d in %s", reason, rt.Attempt, rt.Wait), nil)
+		})
+	}
+}
+
+// storeCSV keeps the YNAB CSV of a parsed statement for owner and returns
+// where to download it from, or "" when it does not fit the cache.
+func (s *Server) storeCSV(owner, name string, local []*models.Transaction) string {
+	name = models.CleanName(name)
+	filename := strings.TrimSuffix(name, filepath.Ext(name)) + "-ynabu.csv"
+	id := s.downloads.add(owner, filename, csv.Create(local, nil))
+	stats := s.downloads.snapshot()
+	s.logger.Debug("download cached", "file", filename, "entries", stats.Entries, "bytes", stats.Bytes, "evictions", stats.Evictions)
+	if id == "" {
+		s.logger.Warn("csv too large to keep for download", "file", filename)
+		return ""
+	}
+	return "/api/files/" + id
+}
+
 // ---------------- file download handler ----------------
 
+// handleFiles serves a CSV kept by storeCSV to whoever processed the
+// statement, until it expires or is evicted.
 func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
-	filename := strings.TrimPrefix(r.URL.Path, "/api/files/")
-	if filename == "" {
-		s.respondError(w, r, http.StatusBadRequest, "filename required", nil)
+	id := strings.TrimPrefix(r.URL.Path, "/api/files/")
+	if id == "" {
+		s.respondError(w, r, http.StatusBadRequest, "file id required", nil)
 		return
 	}
 
-	// Retrieve cached transactions
-	value, ok := s.transactions.Load(filename)
-	if !ok {
-		s.respondError(w, r, http.StatusNotFound, "file not found", nil)
-		return
-	}
-	txs, ok := value.([]*models.Transaction)
+	dl, ok := s.downloads.get(s.scope(r), id)
 	if !ok {
-		s.respondError(w, r, http.StatusInternalServerError, "internal type assertion error", nil)
+		s.respondError(w, r, http.StatusNotFound, "file not found or expired, process the statement again", nil)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	if _, err := w.Write(csv.Create(txs, nil)); err != nil {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": dl.name}))
+	if _, err := w.Write(dl.data); err != nil {
 		s.logger.Warn("failed to write csv response", "err", err)
 	}
 }
 
 // --- helpers ---
 
+// parse parses a statement of the given format, counting it in the
+// metrics.
+func (s *Server) parse(data []byte, format string) ([]*models.Transaction, error) {
+	local, err := s.parser.ProcessBytesAs(data, format)
+	s.metrics.observeParse(format, err)
+	return local, err
+}
+
 // writeJSON encodes v as JSON with the given status and writes headers.
 func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
@@ -349,7 +597,8 @@ func (s *Server) respondError(w http.ResponseWriter, r *http.Request, status int
 	})
 }
 
-// withLogging wraps a handler to log request start/end and recover panics.
+// withLogging wraps a handler to log request start/end, recover panics and
+// refuse cross-site requests, see crossSite.
 func (s *Server) withLogging(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Debug("http request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
@@ -359,6 +608,10 @@ func (s *Server) withLogging(next http.HandlerFunc) http.HandlerFunc {
 				s.respondError(w, r, http.StatusInternalServerError, "internal server error", fmt.Errorf("panic: %v", rec))
 			}
 		}()
+		if crossSite(r) {
+			s.respondError(w, r, http.StatusForbidden, "cross-site request refused", nil)
+			return
+		}
 		next(w, r)
 	}
 }
@@ -0,0 +1,633 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+	"github.com/charmbracelet/log"
+
+	"github.com/yurifrl/ynabu/pkg/config"
+	"github.com/yurifrl/ynabu/pkg/ynab"
+	"github.com/yurifrl/ynabu/pkg/ynab/fake"
+)
+
+const extrato = `17/03/2025;PIX TRANSF ID_A15/03;-2327,00
+17/03/2025;MOBILE PAG TIT 426XXXXXX;-287,00
+19/03/2025;PIX TRANSF ID_C19/03;-1900,00`
+
+func newTestServer(t *testing.T) (*httptest.Server, *fake.Client) {
+	t.Helper()
+
+	client := fake.New()
+	client.AddBudget("budget-1", "Family")
+	client.AddAccount("budget-1", "account-1", "Itaú Conta Corrente")
+
+	srv := New(&config.Config{UseCustomID: true}, log.New(os.Stderr),
+		WithTemplates("../../templates/*.html"),
+		WithClientFactory(func(string) ynab.Client { return client }),
+	)
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts, client
+}
+
+// upload posts the extrato to /api/process as a multipart form with the
+// given extra fields, authenticated with a bearer token, and returns the
+// result of the job it starts.
+func upload(t *testing.T, baseURL string, fields map[string]string) map[string]any {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("statement", "extrato.txt")
+	fw.Write([]byte(extrato))
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/process", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer t")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	job := started(t, baseURL, res)
+	out, ok := job.Result.(map[string]any)
+	if job.Status != JobSucceeded || !ok {
+		t.Fatalf("process job: %+v", job)
+	}
+	return out
+}
+
+// started waits for the job a request started and returns it finished.
+func started(t *testing.T, baseURL string, res *http.Response) Job {
+	t.Helper()
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("%s %s: status %d", res.Request.Method, res.Request.URL, res.StatusCode)
+	}
+	var out struct {
+		Job Job `json:"job"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	job, _ := follow(t, baseURL+"/api/jobs/"+out.Job.ID+"/events")
+	return job
+}
+
+// follow reads the event stream of a job until it is done and returns the
+// finished job and the types of the events before.
+func follow(t *testing.T, url string) (Job, []string) {
+	t.Helper()
+	res, err := get(t, url, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("GET %s: status %d, content type %q", url, res.StatusCode, ct)
+	}
+
+	var types []string
+	event := ""
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			if event == "done" {
+				var job Job
+				if err := json.Unmarshal([]byte(v), &job); err != nil {
+					t.Fatal(err)
+				}
+				return job, types
+			}
+			types = append(types, event)
+		}
+	}
+	t.Fatalf("GET %s: stream ended before the job was done", url)
+	return Job{}, nil
+}
+
+func TestServerProcessAndApply(t *testing.T) {
+	ts, client := newTestServer(t)
+	fields := map[string]string{"budget_id": "budget-1", "account_id": "account-1"}
+
+	out := upload(t, ts.URL, fields)
+	if out["to_add"].(float64) != 3 || out["in_sync"].(float64) != 0 || out["plan_id"] == nil {
+		t.Fatalf("process before apply: %v", out)
+	}
+	planID := out["plan_id"].(string)
+	entries := out["files"].([]any)[0].(map[string]any)["sections"].([]any)[0].(map[string]any)["plan"].(map[string]any)["entries"].([]any)
+	unchecked := entries[1].(map[string]any)["id"].(string)
+
+	// Only the entries left checked are applied.
+	status, job := apply(t, ts.URL, planID, unchecked)
+	if status != http.StatusAccepted || job.Status != JobSucceeded || job.Created != 2 {
+		t.Fatalf("apply: %d %+v", status, job)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 2 {
+		t.Fatalf("expected 2 remote transactions, got %d", got)
+	}
+	// A plan is applied once.
+	if status, _ := apply(t, ts.URL, planID); status != http.StatusNotFound {
+		t.Fatalf("applying a plan twice: status %d", status)
+	}
+
+	out = upload(t, ts.URL, fields)
+	if out["to_add"].(float64) != 1 || out["in_sync"].(float64) != 2 {
+		t.Fatalf("process after apply: %v", out)
+	}
+}
+
+func TestServerApplyRefusesStalePlan(t *testing.T) {
+	ts, client := newTestServer(t)
+	out := upload(t, ts.URL, map[string]string{"budget_id": "budget-1", "account_id": "account-1"})
+
+	// Someone adds a transaction in YNAB between preview and apply.
+	date, _ := api.DateFromString("2025-03-20")
+	client.AddTransaction("budget-1", &transaction.Transaction{AccountID: "account-1", Date: date, Amount: -1000})
+
+	id := out["plan_id"].(string)
+	if _, job := apply(t, ts.URL, id); job.Status != JobFailed || job.Error == nil || job.Error.Code != CodeStalePlan {
+		t.Fatalf("apply of a stale plan: %+v", job)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 1 {
+		t.Fatalf("stale plan created transactions")
+	}
+	// A stale plan is dropped.
+	if status, _ := apply(t, ts.URL, id); status != http.StatusNotFound {
+		t.Fatalf("apply of a dropped plan: status %d", status)
+	}
+}
+
+// flakyClient fails reading transactions while fail is set, like YNAB
+// being briefly unreachable.
+type flakyClient struct {
+	*fake.Client
+	fail *atomic.Bool
+}
+
+func (c flakyClient) GetTransactionsByAccount(budgetID, accountID string, filter *transaction.Filter) ([]*ynab.Transaction, error) {
+	if c.fail.Load() {
+		return nil, errors.New("connection reset")
+	}
+	return c.Client.GetTransactionsByAccount(budgetID, accountID, filter)
+}
+
+func TestServerApplyKeepsPlanOnFailure(t *testing.T) {
+	client := fake.New()
+	client.AddBudget("budget-1", "Family")
+	client.AddAccount("budget-1", "account-1", "Itaú Conta Corrente")
+	var fail atomic.Bool
+	ts := httptest.NewServer(New(&config.Config{UseCustomID: true}, log.New(os.Stderr),
+		WithTemplates("../../templates/*.html"),
+		WithClientFactory(func(string) ynab.Client { return flakyClient{client, &fail} }),
+	))
+	t.Cleanup(ts.Close)
+	out := upload(t, ts.URL, map[string]string{"budget_id": "budget-1", "account_id": "account-1"})
+	id := out["plan_id"].(string)
+
+	fail.Store(true)
+	if _, job := apply(t, ts.URL, id); job.Status != JobFailed {
+		t.Fatalf("apply while YNAB fails: %+v", job)
+	}
+	fail.Store(false)
+	if _, job := apply(t, ts.URL, id); job.Status != JobSucceeded || job.Created != 3 {
+		t.Fatalf("apply of the kept plan: %+v", job)
+	}
+}
+
+// apply applies a plan previewed by /api/process, leaving out the excluded
+// entries, and returns the status and, once finished, the job it started.
+func apply(t *testing.T, baseURL, planID string, exclude ...string) (int, Job) {
+	t.Helper()
+
+	form := url.Values{"plan_id": {planID}, "exclude": exclude}
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/apply", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer t")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		return res.StatusCode, Job{}
+	}
+	return res.StatusCode, started(t, baseURL, res)
+}
+
+// TestServerApplySectionsOfOneAccount applies two sections reconciled with
+// the same account, as when both cards of a fatura are paid from it: the
+// first must not make the second look stale.
+func TestServerApplySectionsOfOneAccount(t *testing.T) {
+	ts, client := newTestServer(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range map[string]string{"march.txt": extrato, "april.txt": "02/04/2025;PIX TRANSF ID_D02/04;-150,00"} {
+		fw, _ := mw.CreateFormFile("statement", name)
+		fw.Write([]byte(data))
+	}
+	mw.WriteField("budget_id", "budget-1")
+	mw.WriteField("account_id", "account-1")
+	mw.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/process", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer t")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	out, _ := started(t, ts.URL, res).Result.(map[string]any)
+	if out["to_add"] != float64(4) {
+		t.Fatalf("process: %+v", out)
+	}
+
+	if status, job := apply(t, ts.URL, out["plan_id"].(string)); status != http.StatusAccepted || job.Status != JobSucceeded || job.Created != 4 {
+		t.Fatalf("apply: status %d, %+v", status, job)
+	}
+	if got := len(client.Transactions("budget-1", "account-1")); got != 4 {
+		t.Fatalf("expected 4 transactions, got %d", got)
+	}
+}
+
+func TestJobsAreBounded(t *testing.T) {
+	j := newJobs()
+	if err := j.add(&Job{ID: "running", Status: JobRunning}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < maxJobs; i++ {
+		if err := j.add(&Job{ID: fmt.Sprint("done-", i), Status: JobSucceeded}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Full: the oldest finished job makes room, never an unfinished one.
+	for i := 0; i < maxQueuedJobs; i++ {
+		if err := j.add(&Job{ID: fmt.Sprint("queued-", i), Status: JobQueued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := j.byID["running"]; !ok || len(j.byID) != maxJobs {
+		t.Fatalf("an unfinished job was forgotten, or too many kept: %d", len(j.byID))
+	}
+	if _, ok := j.byID["done-1"]; ok {
+		t.Error("the oldest finished job should have been forgotten")
+	}
+
+	if !j.busy() {
+		t.Error("expected the queue to be full")
+	}
+	if err := j.add(&Job{ID: "one-too-many", Status: JobQueued}); !errors.Is(err, errBusy) {
+		t.Fatalf("expected errBusy, got %v", err)
+	}
+	if status, apiErr := classify(errBusy); status != http.StatusServiceUnavailable || apiErr.Code != CodeBusy {
+		t.Errorf("errBusy classified as %d %s", status, apiErr.Code)
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	ts, client := newTestServer(t)
+	client.AddAccount("budget-1", "account-2", "Itaú Poupança")
+
+	type batch struct {
+		ToAdd  int        `json:"to_add"`
+		Files  []FileView `json:"files"`
+		PlanID string     `json:"plan_id"`
+	}
+	process := func(names ...string) batch {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, name := range names {
+			fw, _ := mw.CreateFormFile("statement", name)
+			fw.Write([]byte(extrato))
+		}
+		mw.WriteField("budget_id", "budget-1")
+		mw.WriteField("account_id.0", "account-1")
+		mw.WriteField("account_id.1", "account-2")
+		mw.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/process", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer t")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var out batch
+		data, _ := json.Marshal(started(t, ts.URL, res).Result)
+		json.Unmarshal(data, &out)
+		return out
+	}
+
+	out := process("march.txt", "april.txt", "notes.pdf")
+	if out.ToAdd != 6 || len(out.Files) != 3 {
+		t.Fatalf("process: %+v", out)
+	}
+	for i, account := range []string{"account-1", "account-2"} {
+		sec := out.Files[i].Sections[0]
+		if sec.Field != sectionField(i, "") || sec.AccountID != account || sec.Plan == nil || sec.Plan.Summary.ToAdd != 3 {
+			t.Fatalf("file %d: unexpected section %+v", i, sec)
+		}
+	}
+	if out.Files[2].Error == "" {
+		t.Fatalf("expected notes.pdf to fail, got %+v", out.Files[2])
+	}
+
+	if status, job := apply(t, ts.URL, out.PlanID); status != http.StatusAccepted || job.Created != 6 || job.File != "march.txt, april.txt" {
+		t.Fatalf("apply: status %d, %+v", status, job)
+	}
+	for _, account := range []string{"account-1", "account-2"} {
+		if got := len(client.Transactions("budget-1", account)); got != 3 {
+			t.Fatalf("expected 3 transactions in %s, got %d", account, got)
+		}
+	}
+}
+
+func TestServerBudgetsAndAccounts(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	res, err := get(t, ts.URL+"/api/budgets", "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var budgets struct {
+		Budgets []struct{ ID, Name string } `json:"budgets"`
+	}
+	json.NewDecoder(res.Body).Decode(&budgets)
+	res.Body.Close()
+	if len(budgets.Budgets) != 1 || budgets.Budgets[0].Name != "Family" {
+		t.Fatalf("unexpected budgets %+v", budgets)
+	}
+
+	res, err = get(t, ts.URL+"/api/budgets/budget-1", "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accounts struct {
+		Accounts []struct{ ID, Name string } `json:"accounts"`
+	}
+	json.NewDecoder(res.Body).Decode(&accounts)
+	res.Body.Close()
+	if len(accounts.Accounts) != 1 || accounts.Accounts[0].ID != "account-1" {
+		t.Fatalf("unexpected accounts %+v", accounts)
+	}
+}
+
+// get sends a GET request with the token as a bearer token, if any.
+func get(t *testing.T, url, token string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestServerSession(t *testing.T) {
+	ts, _ := newTestServer(t)
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+
+	// Tokens in the URL are ignored.
+	res, err := browser.Get(ts.URL + "/api/budgets?token=t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("query token: status %d, want 401", res.StatusCode)
+	}
+
+	// Another site cannot sign the browser in, to its own account or any.
+	for header, value := range map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/session", strings.NewReader("token=attacker"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(header, value)
+		res, err = browser.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("cross-site sign in with %s: status %d, want 403", header, res.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/session", strings.NewReader("token=t"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.Header.Set("Origin", ts.URL)
+	res, err = browser.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("sign in: status %d", res.StatusCode)
+	}
+	cookies := jar.Cookies(res.Request.URL)
+	if len(cookies) != 1 || cookies[0].Value == "t" {
+		t.Fatalf("unexpected session cookies %v", cookies)
+	}
+
+	res, err = browser.Get(ts.URL + "/api/budgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("budgets with session: status %d", res.StatusCode)
+	}
+
+	// A tampered cookie is rejected.
+	u, _ := url.Parse(ts.URL)
+	jar.SetCookies(u, []*http.Cookie{{Name: sessionCookie, Value: cookies[0].Value[:len(cookies[0].Value)-2] + "xx", Path: "/"}})
+	res, err = browser.Get(ts.URL + "/api/budgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("tampered session: status %d, want 401", res.StatusCode)
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	s, err := newSessions("key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	id, err := s.create(session{Token: "t", Expires: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.get(id); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := s.get(id); err == nil {
+		t.Fatal("expected an expired session")
+	}
+}
+
+func TestSessionsSweepExpired(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSessions("key", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	if _, err := s.create(session{Token: "old", Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.create(session{Token: "new", Expires: now.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := s.create(session{Token: "newer", Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(s.sealed) != 2 || len(entries) != 2 {
+		t.Fatalf("expected the expired session to be swept, got %d in memory and %d files", len(s.sealed), len(entries))
+	}
+	if sess, err := s.get(kept); err != nil || sess.Token != "new" {
+		t.Fatalf("a live session was swept: %+v, %v", sess, err)
+	}
+}
+
+func TestSessionsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSessions("key", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.create(session{Token: "secret-token", Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		data, _ := os.ReadFile(filepath.Join(dir, e.Name()))
+		if bytes.Contains(data, []byte("secret-token")) || strings.Contains(e.Name(), id) {
+			t.Fatalf("session file %s is not sealed", e.Name())
+		}
+	}
+
+	restarted, err := newSessions("key", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := restarted.get(id)
+	if err != nil || sess.Token != "secret-token" {
+		t.Fatalf("got %+v, %v after restart", sess, err)
+	}
+	other, _ := newSessions("another key", dir)
+	if _, err := other.get(id); err == nil {
+		t.Fatal("expected a session sealed with another key to be rejected")
+	}
+}
+
+func TestServerOAuthLogin(t *testing.T) {
+	client := fake.New()
+	client.AddBudget("budget-1", "Family")
+	// Tokens expire within oauth2's expiry margin, so every request
+	// refreshes.
+	client.SetTokenLifetime(time.Second)
+	ynabTS := httptest.NewServer(fake.NewHandler(client, ""))
+	t.Cleanup(ynabTS.Close)
+
+	var (
+		mu   sync.Mutex
+		used []string
+	)
+	var handler http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler.ServeHTTP(w, r) }))
+	t.Cleanup(ts.Close)
+	handler = New(&config.Config{OAuth: config.OAuthConfig{
+		ClientID:     "ynabu",
+		ClientSecret: "secret",
+		RedirectURL:  ts.URL + "/auth/callback",
+		BaseURL:      ynabTS.URL,
+	}}, log.New(os.Stderr),
+		WithTemplates("../../templates/*.html"),
+		WithClientFactory(func(token string) ynab.Client {
+			mu.Lock()
+			defer mu.Unlock()
+			used = append(used, token)
+			return client
+		}),
+	)
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	res, err := browser.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Request.URL.Path != "/" {
+		t.Fatalf("login ended at %s with status %d", res.Request.URL, res.StatusCode)
+	}
+
+	for range 2 {
+		res, err = browser.Get(ts.URL + "/api/budgets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("budgets with OAuth session: status %d", res.StatusCode)
+		}
+	}
+	if len(used) != 2 || used[0] == used[1] || !strings.HasPrefix(used[0], "fake-access-") {
+		t.Fatalf("expected a refreshed token on each request, got %v", used)
+	}
+
+	// A callback without the state cookie of the login is rejected.
+	res, err = http.Get(ts.URL + "/auth/callback?code=code-1&state=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("forged callback: status %d, want 400", res.StatusCode)
+	}
+}
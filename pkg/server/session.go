@@ -0,0 +1,368 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionCookie holds the ID of the session established with
+	// POST /api/session or the OAuth login.
+	sessionCookie = "ynabu_session"
+	// sessionTTL is how long a session lasts before the user has to sign
+	// in again.
+	sessionTTL = 7 * 24 * time.Hour
+	// sweepInterval is how often expired sessions are dropped.
+	sweepInterval = time.Hour
+)
+
+// errNoToken is returned by Server.token when a request carries neither an
+// Authorization header nor a valid session cookie.
+var errNoToken = errors.New("authentication required: send Authorization: Bearer <token> or sign in with POST /api/session")
+
+// errNoSession is returned when a session ID is unknown or expired.
+var errNoSession = errors.New("no such session")
+
+// session is what the server keeps for a signed-in browser. OAuth sessions
+// carry a refresh token and the expiry of Token; sessions started with a
+// personal access token do not.
+type session struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenExpiry  time.Time `json:"token_expiry,omitempty"`
+	Expires      time.Time `json:"expires"`
+}
+
+// sessions stores sessions server side, sealed with AES-GCM: in memory, and
+// under dir when it is set so they survive restarts. The browser only gets a
+// random session ID, and the stored sessions are keyed by its hash, so
+// neither the cookie nor the files give away a token.
+type sessions struct {
+	aead cipher.AEAD
+	dir  string
+	now  func() time.Time
+
+	mu     sync.Mutex
+	sealed map[string][]byte
+	swept  time.Time // when sweep last ran
+}
+
+// newSessions derives the encryption key from secret. An empty secret picks
+// a random key, so sessions do not survive a restart.
+func newSessions(secret, dir string) (*sessions, error) {
+	var key [32]byte
+	if secret == "" {
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+	} else {
+		key = sha256.Sum256([]byte(secret))
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &sessions{aead: aead, dir: dir, now: time.Now, sealed: make(map[string][]byte)}, nil
+}
+
+// create stores a new session and returns its ID, sweeping the expired
+// ones first.
+func (s *sessions) create(sess session) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	s.sweep()
+	return id, s.save(id, sess)
+}
+
+// get returns the session with the given ID, or errNoSession.
+func (s *sessions) get(id string) (*session, error) {
+	key := sessionKey(id)
+	s.mu.Lock()
+	sealed, ok := s.sealed[key]
+	s.mu.Unlock()
+	if !ok && s.dir != "" {
+		data, err := os.ReadFile(filepath.Join(s.dir, key))
+		if err != nil {
+			return nil, errNoSession
+		}
+		sealed = data
+	}
+	sess, err := s.open(key, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if !s.now().Before(sess.Expires) {
+		s.delete(id)
+		return nil, errNoSession
+	}
+	return sess, nil
+}
+
+// open unseals the session stored under key.
+func (s *sessions) open(key string, sealed []byte) (*session, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errNoSession
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		// Sealed with another key, e.g. before a restart without a
+		// session_key.
+		return nil, errNoSession
+	}
+	var sess session
+	if err := json.Unmarshal(plain, &sess); err != nil {
+		return nil, fmt.Errorf("invalid session: %w", err)
+	}
+	return &sess, nil
+}
+
+// sweep forgets the sessions that expired, or can no longer be opened, in
+// memory and under dir. Sessions are only looked at once per sweepInterval,
+// so creating sessions stays cheap.
+func (s *sessions) sweep() {
+	now := s.now()
+	s.mu.Lock()
+	if now.Sub(s.swept) < sweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.swept = now
+	for key, sealed := range s.sealed {
+		if sess, err := s.open(key, sealed); err != nil || !now.Before(sess.Expires) {
+			delete(s.sealed, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		sealed, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if sess, err := s.open(e.Name(), sealed); err != nil || !now.Before(sess.Expires) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// save stores sess under id, replacing what was there.
+func (s *sessions) save(id string, sess session) error {
+	key := sessionKey(id)
+	plain, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, []byte(key))
+
+	s.mu.Lock()
+	s.sealed[key] = sealed
+	s.mu.Unlock()
+	if s.dir == "" {
+		return nil
+	}
+	tmp := filepath.Join(s.dir, key+".tmp")
+	if err := os.WriteFile(tmp, sealed, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, key))
+}
+
+// delete forgets a session.
+func (s *sessions) delete(id string) {
+	key := sessionKey(id)
+	s.mu.Lock()
+	delete(s.sealed, key)
+	s.mu.Unlock()
+	if s.dir != "" {
+		_ = os.Remove(filepath.Join(s.dir, key))
+	}
+}
+
+// writable checks that sessions can still be saved under dir.
+func (s *sessions) writable() error {
+	f, err := os.CreateTemp(s.dir, "ready-*.tmp")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// sessionKey is what a session is stored under: the hash of its ID.
+func sessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// token returns the YNAB token of a request: the Authorization bearer
+// token, or the one of the session in the session cookie, refreshed first if
+// it is an OAuth token about to expire. Tokens are never read from the URL,
+// which ends up in access logs and browser history.
+func (s *Server) token(r *http.Request) (string, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			return "", errors.New("malformed Authorization header, want: Bearer <token>")
+		}
+		return strings.TrimSpace(token), nil
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", errNoToken
+	}
+	sess, err := s.sessions.get(c.Value)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", errNoToken, err)
+	}
+	if sess.RefreshToken != "" {
+		if err := s.refresh(r, c.Value, sess); err != nil {
+			return "", fmt.Errorf("%w (refreshing the YNAB token failed: %v)", errNoToken, err)
+		}
+	}
+	return sess.Token, nil
+}
+
+// handleSession reports (GET), establishes (POST) or ends (DELETE) the
+// browser session. POST takes a personal access token from the Authorization
+// header or a "token" form field and checks it against YNAB before storing
+// it; see handleLogin for signing in with OAuth instead.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		_, err := s.token(r)
+		if err := s.writeJSON(w, http.StatusOK, map[string]any{
+			"status":        "success",
+			"authenticated": err == nil,
+			"oauth":         s.oauth != nil,
+		}); err != nil {
+			s.logger.Warn("failed to write json response", "err", err)
+		}
+	case http.MethodPost:
+		token, err := s.token(r)
+		if errors.Is(err, errNoToken) {
+			token, err = strings.TrimSpace(r.PostFormValue("token")), nil
+		}
+		if err != nil || token == "" {
+			s.respondError(w, r, http.StatusBadRequest, "token required", err)
+			return
+		}
+		user, err := s.newClient(token).GetUser()
+		if err != nil {
+			s.respondError(w, r, http.StatusUnauthorized, "token rejected by YNAB", err)
+			return
+		}
+		if err := s.startSession(w, r, session{Token: token}); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, "failed to create session", err)
+			return
+		}
+		if err := s.writeJSON(w, http.StatusOK, map[string]any{"status": "success", "user_id": user.ID}); err != nil {
+			s.logger.Warn("failed to write json response", "err", err)
+		}
+	case http.MethodDelete:
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			s.sessions.delete(c.Value)
+		}
+		http.SetCookie(w, s.cookie(r, sessionCookie, "", -1))
+		if err := s.writeJSON(w, http.StatusOK, map[string]any{"status": "success"}); err != nil {
+			s.logger.Warn("failed to write json response", "err", err)
+		}
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed", nil)
+	}
+}
+
+// startSession stores sess and hands its ID to the browser.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, sess session) error {
+	sess.Expires = s.sessions.now().Add(sessionTTL)
+	id, err := s.sessions.create(sess)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.cookie(r, sessionCookie, id, int(sessionTTL/time.Second)))
+	return nil
+}
+
+// crossSite reports whether r is a state changing request a browser sent
+// from another site, which must not act with the session cookie nor sign
+// the browser in to someone else's session. Requests with an Authorization
+// header are let through: no other site can make a browser add one without
+// a CORS preflight the server never answers. So are requests without
+// Sec-Fetch-Site or Origin, which do not come from a browser.
+func crossSite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+// cookie builds an HttpOnly cookie. It is only sent over HTTPS when the
+// request came in over HTTPS, directly or through a proxy. SameSite is Lax
+// rather than Strict so the cookie set at the end of the OAuth redirect is
+// sent on the redirect back to the UI; state changing endpoints are POST or
+// DELETE only, which Lax does not send cross-site, and crossSite turns away
+// the cross-site ones that need no cookie, such as signing in.
+func (s *Server) cookie(r *http.Request, name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,191 @@
+package ynab
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+)
+
+// CachedClient keeps a local copy of account transactions on disk, one JSON
+// file per budget, together with the server knowledge they were read at.
+// After the first read of an account only the changes since that knowledge
+// are fetched from YNAB. Every other call goes straight to the wrapped client.
+type CachedClient struct {
+	Client
+	dir string
+	mu  sync.Mutex
+}
+
+// NewCachedClient wraps inner with a transaction cache stored under dir.
+func NewCachedClient(inner Client, dir string) *CachedClient {
+	return &CachedClient{Client: inner, dir: dir}
+}
+
+// OnRetry implements RetryNotifier when the wrapped client does.
+func (c *CachedClient) OnRetry(fn func(Retry)) {
+	if n, ok := c.Client.(RetryNotifier); ok {
+		n.OnRetry(fn)
+	}
+}
+
+// OnRequest implements RequestNotifier when the wrapped client does. Reads
+// served from the cache send no request.
+func (c *CachedClient) OnRequest(fn func(Request)) {
+	if n, ok := c.Client.(RequestNotifier); ok {
+		n.OnRequest(fn)
+	}
+}
+
+// CacheDir returns the cache directory for token under base. Caches are
+// scoped per token so two YNAB users never share transactions.
+func CacheDir(base, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return filepath.Join(base, hex.EncodeToString(sum[:8]))
+}
+
+type budgetCache struct {
+	Accounts map[string]*accountCache `json:"accounts"`
+}
+
+type accountCache struct {
+	ServerKnowledge uint64 `json:"server_knowledge"`
+	// Since is the since_date the cache was seeded with; empty means the
+	// whole history of the account is cached.
+	Since        string                              `json:"since,omitempty"`
+	Transactions map[string]*transaction.Transaction `json:"transactions"`
+}
+
+// covers reports whether the cached transactions include everything on or
+// after since.
+func (a *accountCache) covers(since string) bool {
+	return a.Since == "" || (since != "" && since >= a.Since)
+}
+
+// GetTransactionsByAccount serves the account from the cache, refreshing it
+// with a delta request first. Only filter.Since is honoured.
+func (c *CachedClient) GetTransactionsByAccount(budgetID, accountID string, filter *transaction.Filter) ([]*Transaction, error) {
+	if budgetID == "" || budgetID == "last-used" || budgetID == "default" {
+		// Aliases can point at a different budget tomorrow.
+		return c.Client.GetTransactionsByAccount(budgetID, accountID, filter)
+	}
+
+	var since *api.Date
+	if filter != nil && filter.Since != nil && !filter.Since.IsZero() {
+		since = filter.Since
+	}
+	sinceStr := ""
+	if since != nil {
+		sinceStr = api.DateFormat(*since)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bc, err := c.load(budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := bc.Accounts[accountID]
+	if ac != nil && ac.covers(sinceStr) {
+		var cachedSince *api.Date
+		if ac.Since != "" {
+			d, err := api.DateFromString(ac.Since)
+			if err != nil {
+				return nil, err
+			}
+			cachedSince = &d
+		}
+		delta, knowledge, err := c.Client.GetTransactionsDelta(budgetID, accountID, cachedSince, ac.ServerKnowledge)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range delta {
+			if tx.Deleted {
+				delete(ac.Transactions, tx.ID)
+				continue
+			}
+			ac.Transactions[tx.ID] = tx.Transaction
+		}
+		ac.ServerKnowledge = knowledge
+	} else {
+		txs, knowledge, err := c.Client.GetTransactionsDelta(budgetID, accountID, since, 0)
+		if err != nil {
+			return nil, err
+		}
+		ac = &accountCache{ServerKnowledge: knowledge, Since: sinceStr, Transactions: make(map[string]*transaction.Transaction, len(txs))}
+		for _, tx := range txs {
+			if !tx.Deleted {
+				ac.Transactions[tx.ID] = tx.Transaction
+			}
+		}
+		bc.Accounts[accountID] = ac
+	}
+
+	if err := c.save(budgetID, bc); err != nil {
+		return nil, err
+	}
+
+	out := make([]*Transaction, 0, len(ac.Transactions))
+	for _, tx := range ac.Transactions {
+		if since != nil && tx.Date.Before(since.Time) {
+			continue
+		}
+		cp := *tx
+		out = append(out, NewTransaction(&cp))
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].Date.Equal(out[j].Date.Time) {
+			return out[i].Date.Before(out[j].Date.Time)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (c *CachedClient) path(budgetID string) string {
+	return filepath.Join(c.dir, budgetID+".json")
+}
+
+func (c *CachedClient) load(budgetID string) (*budgetCache, error) {
+	bc := &budgetCache{Accounts: map[string]*accountCache{}}
+	data, err := os.ReadFile(c.path(budgetID))
+	if errors.Is(err, os.ErrNotExist) {
+		return bc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read transaction cache: %w", err)
+	}
+	if err := json.Unmarshal(data, bc); err != nil {
+		// A corrupt cache is not worth failing over; start again.
+		return &budgetCache{Accounts: map[string]*accountCache{}}, nil
+	}
+	if bc.Accounts == nil {
+		bc.Accounts = map[string]*accountCache{}
+	}
+	return bc, nil
+}
+
+func (c *CachedClient) save(budgetID string, bc *budgetCache) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("create transaction cache: %w", err)
+	}
+	data, err := json.Marshal(bc)
+	if err != nil {
+		return err
+	}
+	tmp := c.path(budgetID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write transaction cache: %w", err)
+	}
+	return os.Rename(tmp, c.path(budgetID))
+}
@@ -0,0 +1,96 @@
+package ynab_test
+
+import (
+	"testing"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/ynab"
+	"github.com/yurifrl/ynabu/pkg/ynab/fake"
+)
+
+func TestCachedClientDeltaSync(t *testing.T) {
+	remote := fake.New()
+	remote.AddBudget("b", "Budget")
+	remote.AddAccount("b", "a", "Account")
+
+	payee := "PADARIA"
+	old, _ := api.DateFromString("2025-01-10")
+	recent, _ := api.DateFromString("2025-03-17")
+	sum, err := remote.CreateTransactions("b", []transaction.PayloadTransaction{
+		{AccountID: "a", Date: old, Amount: -1000, PayeeName: &payee},
+		{AccountID: "a", Date: recent, Amount: -2000, PayeeName: &payee},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	c := ynab.NewCachedClient(remote, dir)
+	txs, err := c.GetTransactionsByAccount("b", "a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(txs))
+	}
+
+	// Changes made on the server arrive through the delta, including deletes.
+	if err := remote.DeleteTransaction("b", sum.TransactionIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.CreateTransactions("b", []transaction.PayloadTransaction{
+		{AccountID: "a", Date: recent, Amount: -3000, PayeeName: &payee},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh client reads the cache left on disk.
+	c = ynab.NewCachedClient(remote, dir)
+	txs, err = c.GetTransactionsByAccount("b", "a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 || txs[0].ID == sum.TransactionIDs[0] {
+		t.Fatalf("cache did not apply the delta: %+v", txs)
+	}
+
+	since := &transaction.Filter{Since: &recent}
+	if txs, _ = c.GetTransactionsByAccount("b", "a", since); len(txs) != 2 {
+		t.Fatalf("expected 2 transactions since %s, got %d", api.DateFormat(recent), len(txs))
+	}
+
+	if n := remote.Calls("GetTransactionsByAccount"); n != 0 {
+		t.Errorf("expected no full reads, got %d", n)
+	}
+	if n := remote.Calls("GetTransactionsDelta"); n != 3 {
+		t.Errorf("expected 3 delta reads, got %d", n)
+	}
+}
+
+func TestCachedClientNarrowSinceRefetches(t *testing.T) {
+	remote := fake.New()
+	remote.AddBudget("b", "Budget")
+	remote.AddAccount("b", "a", "Account")
+
+	payee := "PADARIA"
+	old, _ := api.DateFromString("2025-01-10")
+	recent, _ := api.DateFromString("2025-03-17")
+	if _, err := remote.CreateTransactions("b", []transaction.PayloadTransaction{
+		{AccountID: "a", Date: old, Amount: -1000, PayeeName: &payee},
+		{AccountID: "a", Date: recent, Amount: -2000, PayeeName: &payee},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := ynab.NewCachedClient(remote, t.TempDir())
+	if txs, _ := c.GetTransactionsByAccount("b", "a", &transaction.Filter{Since: &recent}); len(txs) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(txs))
+	}
+	// The cache only covers dates from recent on, so an earlier bound must
+	// not be answered from it.
+	if txs, _ := c.GetTransactionsByAccount("b", "a", &transaction.Filter{Since: &old}); len(txs) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(txs))
+	}
+}
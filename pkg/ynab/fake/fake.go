@@ -0,0 +1,542 @@
+// Package fake provides an in-memory implementation of ynab.Client for tests
+// and offline development.
+//
+// It mimics the parts of YNAB's behaviour ynabu relies on, including
+// server_knowledge: every mutation bumps a global knowledge counter and
+// stamps the changed entity with it, deleted transactions are kept as
+// tombstones and only show up in delta reads (TransactionsSince), and payees
+// are created on the fly from payee names.
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/budget"
+	"github.com/brunomvsouza/ynab.go/api/category"
+	"github.com/brunomvsouza/ynab.go/api/payee"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+	"github.com/brunomvsouza/ynab.go/api/user"
+
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// Client is an in-memory YNAB. The zero value is not usable, use New.
+type Client struct {
+	mu        sync.Mutex
+	knowledge uint64
+	nextID    int
+	budgets   []*budgetState
+	calls     map[string]int
+	quota     ynab.RateLimit
+	oauth     oauthState
+}
+
+var _ ynab.Client = (*Client)(nil)
+
+type budgetState struct {
+	summary      *budget.Summary
+	accounts     []*account.Account
+	categories   []*category.GroupWithCategories
+	payees       []*payee.Payee
+	transactions []*record
+}
+
+type record struct {
+	tx        *transaction.Transaction
+	knowledge uint64
+}
+
+// New returns an empty fake.
+func New() *Client {
+	return &Client{calls: make(map[string]int)}
+}
+
+// AddBudget seeds a budget. The first budget added is also the one
+// "last-used" and "default" resolve to.
+func (c *Client) AddBudget(id, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budgets = append(c.budgets, &budgetState{summary: &budget.Summary{ID: id, Name: name}})
+}
+
+// AddAccount seeds an on-budget checking account into an existing budget.
+func (c *Client) AddAccount(budgetID, id, name string) {
+	c.SeedAccount(budgetID, account.Account{ID: id, Name: name, Type: account.TypeChecking, OnBudget: true})
+}
+
+// SeedAccount seeds an account as given, type and on_budget included, into
+// an existing budget. Accounts without a type are checking accounts.
+func (c *Client) SeedAccount(budgetID string, a account.Account) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.mustBudget(budgetID)
+	if a.Type == "" {
+		a.Type = account.TypeChecking
+	}
+	b.accounts = append(b.accounts, &a)
+}
+
+// AddCategory seeds a category, creating its group when needed.
+func (c *Client) AddCategory(budgetID, group, id, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.mustBudget(budgetID)
+	for _, g := range b.categories {
+		if g.Name == group {
+			g.Categories = append(g.Categories, &category.Category{ID: id, CategoryGroupID: g.ID, Name: name})
+			return
+		}
+	}
+	gid := c.newID("group")
+	b.categories = append(b.categories, &category.GroupWithCategories{
+		ID:         gid,
+		Name:       group,
+		Categories: []*category.Category{{ID: id, CategoryGroupID: gid, Name: name}},
+	})
+}
+
+// AddTransaction seeds a transaction as if it already existed remotely. An
+// ID is assigned when tx has none. The stored copy is returned.
+func (c *Client) AddTransaction(budgetID string, tx *transaction.Transaction) *transaction.Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.mustBudget(budgetID)
+	stored := *tx
+	if stored.ID == "" {
+		stored.ID = c.newID("tx")
+	}
+	c.knowledge++
+	b.transactions = append(b.transactions, &record{tx: &stored, knowledge: c.knowledge})
+	out := stored
+	return &out
+}
+
+// Transactions returns every transaction of an account, including deleted
+// ones, for assertions.
+func (c *Client) Transactions(budgetID, accountID string) []*transaction.Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.mustBudget(budgetID)
+	var out []*transaction.Transaction
+	for _, r := range b.transactions {
+		if r.tx.AccountID == accountID {
+			tx := *r.tx
+			out = append(out, &tx)
+		}
+	}
+	return out
+}
+
+// allTransactions returns copies of every transaction of a budget, deleted
+// ones included.
+func (c *Client) allTransactions(budgetID string) []*transaction.Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil
+	}
+	out := make([]*transaction.Transaction, 0, len(b.transactions))
+	for _, r := range b.transactions {
+		tx := *r.tx
+		out = append(out, &tx)
+	}
+	return out
+}
+
+// ServerKnowledge returns the current knowledge counter.
+func (c *Client) ServerKnowledge() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.knowledge
+}
+
+// Calls returns how many times the named Client method was called.
+func (c *Client) Calls(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+// SetRateLimit sets the quota RateLimit reports. Served over HTTP (see
+// NewHandler) every request then counts against it, and requests past the
+// limit are answered with 429.
+func (c *Client) SetRateLimit(used, limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quota = ynab.RateLimit{Used: used, Limit: limit}
+}
+
+func (c *Client) RateLimit() ynab.RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quota
+}
+
+// useQuota counts one request against the quota, reporting false when it
+// is exhausted. Without a quota every request is allowed.
+func (c *Client) useQuota() (ynab.RateLimit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.quota.Known() {
+		return c.quota, true
+	}
+	if c.quota.Used >= c.quota.Limit {
+		return c.quota, false
+	}
+	c.quota.Used++
+	return c.quota, true
+}
+
+// TransactionsSince returns the transactions of an account changed after
+// lastKnowledge, deleted ones included, together with the current server
+// knowledge – the semantics of YNAB's last_knowledge_of_server parameter.
+func (c *Client) TransactionsSince(budgetID, accountID string, lastKnowledge uint64) ([]*transaction.Transaction, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var out []*transaction.Transaction
+	for _, r := range b.transactions {
+		if r.tx.AccountID == accountID && r.knowledge > lastKnowledge {
+			tx := *r.tx
+			out = append(out, &tx)
+		}
+	}
+	return out, c.knowledge, nil
+}
+
+// UserID is the ID of the user every fake token belongs to.
+const UserID = "fake-user"
+
+func (c *Client) GetUser() (*user.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetUser"]++
+	return &user.User{ID: UserID}, nil
+}
+
+func (c *Client) GetBudgets() ([]*budget.Summary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetBudgets"]++
+	out := make([]*budget.Summary, 0, len(c.budgets))
+	for _, b := range c.budgets {
+		s := *b.summary
+		out = append(out, &s)
+	}
+	return out, nil
+}
+
+func (c *Client) GetBudgetID(budgetID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetBudgetID"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return "", err
+	}
+	return b.summary.ID, nil
+}
+
+func (c *Client) GetAccounts(budgetID string) ([]*account.Account, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetAccounts"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*account.Account, 0, len(b.accounts))
+	for _, a := range b.accounts {
+		acc := *a
+		out = append(out, &acc)
+	}
+	return out, nil
+}
+
+func (c *Client) GetCategories(budgetID string) ([]*category.GroupWithCategories, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetCategories"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*category.GroupWithCategories, 0, len(b.categories))
+	for _, g := range b.categories {
+		group := *g
+		group.Categories = append([]*category.Category(nil), g.Categories...)
+		out = append(out, &group)
+	}
+	return out, nil
+}
+
+func (c *Client) GetPayees(budgetID string) ([]*payee.Payee, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetPayees"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*payee.Payee, 0, len(b.payees))
+	for _, p := range b.payees {
+		py := *p
+		out = append(out, &py)
+	}
+	return out, nil
+}
+
+func (c *Client) GetTransactionsByAccount(budgetID, accountID string, filter *transaction.Filter) ([]*ynab.Transaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["GetTransactionsByAccount"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, err
+	}
+	if b.account(accountID) == nil {
+		return nil, notFound("account", accountID)
+	}
+
+	var out []*ynab.Transaction
+	for _, r := range b.transactions {
+		if r.tx.AccountID != accountID || r.tx.Deleted {
+			continue
+		}
+		if filter != nil && filter.Since != nil && r.tx.Date.Before(filter.Since.Time) {
+			continue
+		}
+		tx := *r.tx
+		out = append(out, ynab.NewTransaction(&tx))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date.Time) })
+	return out, nil
+}
+
+func (c *Client) GetTransactionsDelta(budgetID, accountID string, since *api.Date, lastKnowledge uint64) ([]*ynab.Transaction, uint64, error) {
+	c.mu.Lock()
+	c.calls["GetTransactionsDelta"]++
+	c.mu.Unlock()
+
+	txs, knowledge, err := c.TransactionsSince(budgetID, accountID, lastKnowledge)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]*ynab.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if lastKnowledge == 0 && tx.Deleted {
+			continue // like YNAB, full reads never include tombstones
+		}
+		if since != nil && tx.Date.Before(since.Time) {
+			continue
+		}
+		out = append(out, ynab.NewTransaction(tx))
+	}
+	return out, knowledge, nil
+}
+
+func (c *Client) CreateTransactions(budgetID string, payloads []transaction.PayloadTransaction) (*transaction.OperationSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["CreateTransactions"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the whole batch first: YNAB rejects it atomically.
+	for i, p := range payloads {
+		if err := b.validate(p); err != nil {
+			return nil, badRequest(fmt.Sprintf("transactions[%d]: %s", i, err))
+		}
+	}
+
+	summary := &transaction.OperationSummary{TransactionIDs: []string{}}
+	for _, p := range payloads {
+		if p.ImportID != nil && b.hasImportID(p.AccountID, *p.ImportID) {
+			summary.DuplicateImportIDs = append(summary.DuplicateImportIDs, *p.ImportID)
+			continue
+		}
+		tx := &transaction.Transaction{ID: c.newID("tx")}
+		c.apply(b, tx, p)
+		c.knowledge++
+		b.transactions = append(b.transactions, &record{tx: tx, knowledge: c.knowledge})
+		summary.TransactionIDs = append(summary.TransactionIDs, tx.ID)
+		out := *tx
+		summary.Transactions = append(summary.Transactions, &out)
+	}
+	return summary, nil
+}
+
+func (c *Client) UpdateTransactions(budgetID string, payloads []transaction.PayloadTransaction) (*transaction.OperationSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["UpdateTransactions"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*record, len(payloads))
+	for i, p := range payloads {
+		records[i] = b.transaction(p.ID)
+		if records[i] == nil {
+			return nil, notFound("transaction", p.ID)
+		}
+		if err := b.validate(p); err != nil {
+			return nil, badRequest(fmt.Sprintf("transactions[%d]: %s", i, err))
+		}
+	}
+
+	summary := &transaction.OperationSummary{TransactionIDs: []string{}}
+	for i, p := range payloads {
+		r := records[i]
+		c.apply(b, r.tx, p)
+		c.knowledge++
+		r.knowledge = c.knowledge
+		summary.TransactionIDs = append(summary.TransactionIDs, r.tx.ID)
+		out := *r.tx
+		summary.Transactions = append(summary.Transactions, &out)
+	}
+	return summary, nil
+}
+
+func (c *Client) DeleteTransaction(budgetID, transactionID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls["DeleteTransaction"]++
+	b, err := c.budget(budgetID)
+	if err != nil {
+		return err
+	}
+	r := b.transaction(transactionID)
+	if r == nil {
+		return notFound("transaction", transactionID)
+	}
+	r.tx.Deleted = true
+	c.knowledge++
+	r.knowledge = c.knowledge
+	return nil
+}
+
+// apply copies a payload onto tx, resolving the payee like YNAB does.
+func (c *Client) apply(b *budgetState, tx *transaction.Transaction, p transaction.PayloadTransaction) {
+	acc := b.account(p.AccountID)
+	tx.AccountID = acc.ID
+	tx.AccountName = acc.Name
+	tx.Date = p.Date
+	tx.Amount = p.Amount
+	tx.Cleared = p.Cleared
+	tx.Approved = p.Approved
+	tx.Memo = p.Memo
+	tx.FlagColor = p.FlagColor
+	tx.CategoryID = p.CategoryID
+	tx.ImportID = p.ImportID
+	tx.PayeeID = p.PayeeID
+	tx.PayeeName = p.PayeeName
+
+	if p.PayeeID == nil && p.PayeeName != nil {
+		py := b.payeeByName(*p.PayeeName)
+		if py == nil {
+			py = &payee.Payee{ID: c.newID("payee"), Name: *p.PayeeName}
+			b.payees = append(b.payees, py)
+		}
+		id := py.ID
+		tx.PayeeID = &id
+	}
+}
+
+func (c *Client) newID(prefix string) string {
+	c.nextID++
+	return fmt.Sprintf("%s-%04d", prefix, c.nextID)
+}
+
+func (c *Client) budget(id string) (*budgetState, error) {
+	if (id == "last-used" || id == "default") && len(c.budgets) > 0 {
+		return c.budgets[0], nil
+	}
+	for _, b := range c.budgets {
+		if b.summary.ID == id {
+			return b, nil
+		}
+	}
+	return nil, notFound("budget", id)
+}
+
+func (c *Client) mustBudget(id string) *budgetState {
+	b, err := c.budget(id)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (b *budgetState) account(id string) *account.Account {
+	for _, a := range b.accounts {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+func (b *budgetState) transaction(id string) *record {
+	for _, r := range b.transactions {
+		if r.tx.ID == id && !r.tx.Deleted {
+			return r
+		}
+	}
+	return nil
+}
+
+func (b *budgetState) payeeByName(name string) *payee.Payee {
+	for _, p := range b.payees {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (b *budgetState) hasImportID(accountID, importID string) bool {
+	for _, r := range b.transactions {
+		if r.tx.AccountID == accountID && r.tx.ImportID != nil && *r.tx.ImportID == importID && !r.tx.Deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// validate applies the payload checks YNAB performs that matter to ynabu.
+func (b *budgetState) validate(p transaction.PayloadTransaction) error {
+	if b.account(p.AccountID) == nil {
+		return fmt.Errorf("account_id %q does not exist", p.AccountID)
+	}
+	if p.Date.IsZero() {
+		return fmt.Errorf("date is required")
+	}
+	if p.PayeeName != nil && len(*p.PayeeName) > 200 {
+		return fmt.Errorf("payee_name is too long (maximum is 200 characters)")
+	}
+	if p.Memo != nil && len(*p.Memo) > 500 {
+		return fmt.Errorf("memo is too long (maximum is 500 characters)")
+	}
+	return nil
+}
+
+func notFound(kind, id string) error {
+	return &api.Error{ID: "404.2", Name: "resource_not_found", Detail: fmt.Sprintf("%s %s not found", kind, id)}
+}
+
+func badRequest(detail string) error {
+	return &api.Error{ID: "400", Name: "bad_request", Detail: detail}
+}
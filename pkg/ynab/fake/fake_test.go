@@ -0,0 +1,65 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+)
+
+func TestServerKnowledgeDelta(t *testing.T) {
+	c := New()
+	c.AddBudget("b", "Budget")
+	c.AddAccount("b", "a", "Account")
+
+	date, _ := api.DateFromString("2025-03-17")
+	payee := "PADARIA"
+	sum, err := c.CreateTransactions("b", []transaction.PayloadTransaction{
+		{AccountID: "a", Date: date, Amount: -1000, PayeeName: &payee},
+		{AccountID: "a", Date: date, Amount: -2000, PayeeName: &payee},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, knowledge, _ := c.TransactionsSince("b", "a", 0)
+	if err := c.DeleteTransaction("b", sum.TransactionIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	delta, _, err := c.TransactionsSince("b", "a", knowledge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta) != 1 || delta[0].ID != sum.TransactionIDs[0] || !delta[0].Deleted {
+		t.Fatalf("expected only the deleted transaction in the delta, got %+v", delta)
+	}
+
+	txs, _ := c.GetTransactionsByAccount("b", "a", nil)
+	if len(txs) != 1 {
+		t.Fatalf("deleted transactions must not show up in full reads, got %d", len(txs))
+	}
+
+	payees, _ := c.GetPayees("b")
+	if len(payees) != 1 || *txs[0].PayeeID != payees[0].ID {
+		t.Errorf("payee was not resolved by name: %+v", payees)
+	}
+}
+
+func TestCreateRejectsWholeBatch(t *testing.T) {
+	c := New()
+	c.AddBudget("b", "Budget")
+	c.AddAccount("b", "a", "Account")
+
+	date, _ := api.DateFromString("2025-03-17")
+	_, err := c.CreateTransactions("b", []transaction.PayloadTransaction{
+		{AccountID: "a", Date: date, Amount: -1000},
+		{AccountID: "missing", Date: date, Amount: -2000},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unknown account")
+	}
+	if n := len(c.Transactions("b", "a")); n != 0 {
+		t.Errorf("a rejected batch must not create anything, got %d", n)
+	}
+}
@@ -0,0 +1,117 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTokenLifetime is how long OAuth access tokens issued by the fake
+// last, the same as YNAB's.
+const DefaultTokenLifetime = 2 * time.Hour
+
+// oauthState tracks the codes and refresh tokens the OAuth stand-in issued.
+type oauthState struct {
+	lifetime time.Duration
+	issued   int
+	codes    map[string]bool
+	refresh  map[string]bool
+}
+
+// SetTokenLifetime changes the lifetime of the access tokens the OAuth
+// stand-in issues, e.g. to exercise refreshes in tests.
+func (c *Client) SetTokenLifetime(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.oauth.lifetime = d
+}
+
+// issueCode returns a new authorization code.
+func (c *Client) issueCode() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.oauth.issued++
+	code := fmt.Sprintf("code-%d", c.oauth.issued)
+	if c.oauth.codes == nil {
+		c.oauth.codes = make(map[string]bool)
+	}
+	c.oauth.codes[code] = true
+	return code
+}
+
+// redeem consumes an authorization code or refresh token and issues a new
+// access and refresh token pair; ok is false for unknown or reused grants.
+func (c *Client) redeem(grantType, grant string) (access, refresh string, lifetime time.Duration, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pool map[string]bool
+	switch grantType {
+	case "authorization_code":
+		pool = c.oauth.codes
+	case "refresh_token":
+		pool = c.oauth.refresh
+	}
+	if !pool[grant] {
+		return "", "", 0, false
+	}
+	delete(pool, grant)
+
+	c.oauth.issued++
+	access = fmt.Sprintf("fake-access-%d", c.oauth.issued)
+	refresh = fmt.Sprintf("fake-refresh-%d", c.oauth.issued)
+	if c.oauth.refresh == nil {
+		c.oauth.refresh = make(map[string]bool)
+	}
+	c.oauth.refresh[refresh] = true
+	lifetime = c.oauth.lifetime
+	if lifetime == 0 {
+		lifetime = DefaultTokenLifetime
+	}
+	return access, refresh, lifetime, true
+}
+
+// authorize approves every authorization request straight away, redirecting
+// back with a code as YNAB does once the user allows access.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" || q.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", h.c.issueCode())
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// issueToken implements the authorization_code and refresh_token grants. Tokens
+// are opaque; when the handler only accepts one API token, that token is
+// issued instead so it works against /v1.
+func (h *handler) issueToken(w http.ResponseWriter, r *http.Request) {
+	grantType := r.PostFormValue("grant_type")
+	grant := r.PostFormValue("code")
+	if grantType == "refresh_token" {
+		grant = r.PostFormValue("refresh_token")
+	}
+
+	access, refresh, lifetime, ok := h.c.redeem(grantType, grant)
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if h.token != "" {
+		access = h.token
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"expires_in":    int(lifetime / time.Second),
+		"refresh_token": refresh,
+	})
+}
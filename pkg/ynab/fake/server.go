@@ -0,0 +1,350 @@
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+)
+
+// Fixture is the JSON document a fake can be loaded from.
+type Fixture struct {
+	Budgets []FixtureBudget `json:"budgets"`
+}
+
+// FixtureBudget seeds one budget with its accounts, categories and existing
+// transactions.
+type FixtureBudget struct {
+	ID           string                     `json:"id"`
+	Name         string                     `json:"name"`
+	Accounts     []account.Account          `json:"accounts"`
+	Categories   []FixtureCategory          `json:"categories"`
+	Transactions []*transaction.Transaction `json:"transactions"`
+}
+
+// FixtureCategory is a category together with the name of its group.
+type FixtureCategory struct {
+	Group string `json:"group"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+}
+
+// Load builds a fake from a JSON fixture file.
+func Load(path string) (*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+
+	c := New()
+	for _, b := range f.Budgets {
+		c.AddBudget(b.ID, b.Name)
+		for _, a := range b.Accounts {
+			c.SeedAccount(b.ID, a)
+		}
+		for _, cat := range b.Categories {
+			c.AddCategory(b.ID, cat.Group, cat.ID, cat.Name)
+		}
+		for _, tx := range b.Transactions {
+			c.AddTransaction(b.ID, tx)
+		}
+	}
+	return c, nil
+}
+
+// NewHandler serves the subset of the YNAB v1 REST API used by ynabu, backed
+// by c, under /v1. When token is not empty requests must present it as a
+// bearer token; otherwise any bearer token is accepted.
+//
+// It also stands in for YNAB's OAuth server: /oauth/authorize approves every
+// request and /oauth/token issues tokens for the codes and refresh tokens it
+// handed out.
+func NewHandler(c *Client, token string) http.Handler {
+	h := &handler{c: c, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/user", h.user)
+	mux.HandleFunc("GET /v1/budgets", h.budgets)
+	mux.HandleFunc("GET /v1/budgets/{budget}", h.budget)
+	mux.HandleFunc("GET /v1/budgets/{budget}/accounts", h.accounts)
+	mux.HandleFunc("GET /v1/budgets/{budget}/categories", h.categories)
+	mux.HandleFunc("GET /v1/budgets/{budget}/payees", h.payees)
+	mux.HandleFunc("GET /v1/budgets/{budget}/accounts/{account}/transactions", h.transactions)
+	mux.HandleFunc("POST /v1/budgets/{budget}/transactions", h.create)
+	mux.HandleFunc("POST /v1/budgets/{budget}/transactions/bulk", h.bulk)
+	mux.HandleFunc("PATCH /v1/budgets/{budget}/transactions", h.update)
+	mux.HandleFunc("PUT /v1/budgets/{budget}/transactions/{id}", h.updateOne)
+	mux.HandleFunc("DELETE /v1/budgets/{budget}/transactions/{id}", h.delete)
+
+	root := http.NewServeMux()
+	root.Handle("/v1/", h.auth(mux))
+	root.HandleFunc("GET /oauth/authorize", h.authorize)
+	root.HandleFunc("POST /oauth/token", h.issueToken)
+	return root
+}
+
+type handler struct {
+	c     *Client
+	token string
+}
+
+func (h *handler) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || got == "" || (h.token != "" && got != h.token) {
+			writeError(w, &api.Error{ID: "401", Name: "unauthorized", Detail: "Unauthorized"})
+			return
+		}
+		quota, ok := h.c.useQuota()
+		if quota.Known() {
+			w.Header().Set("X-Rate-Limit", fmt.Sprintf("%d/%d", quota.Used, quota.Limit))
+		}
+		if !ok {
+			w.Header().Set("Retry-After", "3600")
+			writeError(w, &api.Error{ID: "429", Name: "too_many_requests", Detail: "Too many requests"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) user(w http.ResponseWriter, r *http.Request) {
+	u, err := h.c.GetUser()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"user": u})
+}
+
+func (h *handler) budgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := h.c.GetBudgets()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"budgets": budgets})
+}
+
+// budget answers with the ID of the budget only, about what YNAB sends for
+// a server knowledge past every change.
+func (h *handler) budget(w http.ResponseWriter, r *http.Request) {
+	id, err := h.c.GetBudgetID(r.PathValue("budget"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"budget": map[string]string{"id": id}, "server_knowledge": h.c.ServerKnowledge()})
+}
+
+func (h *handler) accounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.c.GetAccounts(r.PathValue("budget"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"accounts": accounts, "server_knowledge": h.c.ServerKnowledge()})
+}
+
+func (h *handler) categories(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.c.GetCategories(r.PathValue("budget"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"category_groups": groups, "server_knowledge": h.c.ServerKnowledge()})
+}
+
+func (h *handler) payees(w http.ResponseWriter, r *http.Request) {
+	payees, err := h.c.GetPayees(r.PathValue("budget"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"payees": payees, "server_knowledge": h.c.ServerKnowledge()})
+}
+
+func (h *handler) transactions(w http.ResponseWriter, r *http.Request) {
+	budgetID, accountID := r.PathValue("budget"), r.PathValue("account")
+	q := r.URL.Query()
+
+	var since *api.Date
+	if s := q.Get("since_date"); s != "" {
+		d, err := api.DateFromString(s)
+		if err != nil {
+			writeError(w, badRequest("invalid since_date"))
+			return
+		}
+		since = &d
+	}
+
+	var txs []*transaction.Transaction
+	var knowledge uint64
+	if lk := q.Get("last_knowledge_of_server"); lk != "" {
+		last, err := strconv.ParseUint(lk, 10, 64)
+		if err != nil {
+			writeError(w, badRequest("invalid last_knowledge_of_server"))
+			return
+		}
+		if txs, knowledge, err = h.c.TransactionsSince(budgetID, accountID, last); err != nil {
+			writeError(w, err)
+			return
+		}
+	} else {
+		wrapped, err := h.c.GetTransactionsByAccount(budgetID, accountID, nil)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, tx := range wrapped {
+			txs = append(txs, tx.Transaction)
+		}
+		knowledge = h.c.ServerKnowledge()
+	}
+
+	out := make([]*transaction.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if since == nil || !tx.Date.Before(since.Time) {
+			out = append(out, tx)
+		}
+	}
+	writeData(w, http.StatusOK, map[string]any{"transactions": out, "server_knowledge": knowledge})
+}
+
+// payloads decodes both the single ("transaction") and the multiple
+// ("transactions") request shapes, reporting which one was sent.
+func payloads(r *http.Request) ([]transaction.PayloadTransaction, bool, error) {
+	var body struct {
+		Transaction  *transaction.PayloadTransaction  `json:"transaction"`
+		Transactions []transaction.PayloadTransaction `json:"transactions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, false, badRequest("invalid JSON body: " + err.Error())
+	}
+	if body.Transaction != nil {
+		return []transaction.PayloadTransaction{*body.Transaction}, true, nil
+	}
+	return body.Transactions, false, nil
+}
+
+func (h *handler) create(w http.ResponseWriter, r *http.Request) {
+	ps, single, err := payloads(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	summary, err := h.c.CreateTransactions(r.PathValue("budget"), ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusCreated, withKnowledge(summary, h.c.ServerKnowledge(), single))
+}
+
+func (h *handler) bulk(w http.ResponseWriter, r *http.Request) {
+	ps, _, err := payloads(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	summary, err := h.c.CreateTransactions(r.PathValue("budget"), ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusCreated, map[string]any{"bulk": transaction.Bulk{
+		TransactionIDs:     summary.TransactionIDs,
+		DuplicateImportIDs: summary.DuplicateImportIDs,
+	}})
+}
+
+func (h *handler) update(w http.ResponseWriter, r *http.Request) {
+	ps, single, err := payloads(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	summary, err := h.c.UpdateTransactions(r.PathValue("budget"), ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, withKnowledge(summary, h.c.ServerKnowledge(), single))
+}
+
+func (h *handler) updateOne(w http.ResponseWriter, r *http.Request) {
+	ps, _, err := payloads(r)
+	if err != nil || len(ps) != 1 {
+		writeError(w, badRequest("expected a single transaction"))
+		return
+	}
+	ps[0].ID = r.PathValue("id")
+	summary, err := h.c.UpdateTransactions(r.PathValue("budget"), ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, map[string]any{"transaction": summary.Transactions[0]})
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	budgetID, id := r.PathValue("budget"), r.PathValue("id")
+	if err := h.c.DeleteTransaction(budgetID, id); err != nil {
+		writeError(w, err)
+		return
+	}
+	var deleted *transaction.Transaction
+	for _, tx := range h.c.allTransactions(budgetID) {
+		if tx.ID == id {
+			deleted = tx
+		}
+	}
+	writeData(w, http.StatusOK, map[string]any{"transaction": deleted})
+}
+
+// withKnowledge flattens an operation summary next to server_knowledge, the
+// shape YNAB uses for transaction writes: a single "transaction" answers a
+// request with a single one, "transactions" a list, however long.
+func withKnowledge(s *transaction.OperationSummary, knowledge uint64, single bool) map[string]any {
+	out := map[string]any{
+		"transaction_ids":      s.TransactionIDs,
+		"duplicate_import_ids": s.DuplicateImportIDs,
+		"server_knowledge":     knowledge,
+	}
+	if single && len(s.Transactions) == 1 {
+		out["transaction"] = s.Transactions[0]
+	} else {
+		out["transactions"] = s.Transactions
+	}
+	return out
+}
+
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = &api.Error{ID: "500", Name: "internal_server_error", Detail: err.Error()}
+	}
+	status, convErr := strconv.Atoi(strings.SplitN(apiErr.ID, ".", 2)[0])
+	if convErr != nil {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": apiErr})
+}
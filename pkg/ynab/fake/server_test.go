@@ -0,0 +1,101 @@
+package fake
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+
+	"github.com/yurifrl/ynabu/pkg/ynab"
+)
+
+// TestHandlerWithRealClient drives the HTTP mock through the production
+// client, checking both speak the same wire format.
+func TestHandlerWithRealClient(t *testing.T) {
+	c, err := Load("../../../hack/mock-ynab.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewHandler(c, "secret"))
+	defer ts.Close()
+
+	client := ynab.NewWithBaseURL("secret", ts.URL+"/v1")
+
+	budgets, err := client.GetBudgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgetID := budgets[0].ID
+	if id, err := client.GetBudgetID(ynab.LastUsedBudget); err != nil || id != budgetID {
+		t.Errorf("last-used resolved to %q, %v", id, err)
+	}
+	accounts, err := client.GetAccounts(budgetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountID := accounts[0].ID
+	if accounts[1].Type != account.TypeCreditCard {
+		t.Errorf("the fixture's account type was not kept: %+v", accounts[1])
+	}
+
+	date, _ := api.DateFromString("2025-03-18")
+	payee := "MERCADO"
+	summary, err := client.CreateTransactions(budgetID, []transaction.PayloadTransaction{
+		{AccountID: accountID, Date: date, Amount: -80000, PayeeName: &payee},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.TransactionIDs) != 1 || len(summary.Transactions) != 1 || summary.Transactions[0].ID != summary.TransactionIDs[0] {
+		t.Fatalf("expected 1 created transaction, got %+v", summary)
+	}
+
+	txs, err := client.GetTransactionsByAccount(budgetID, accountID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 || txs[0].CustomID() != "b0bd2a1f0c0a64a6" {
+		t.Fatalf("unexpected transactions %+v", txs)
+	}
+
+	if err := client.DeleteTransaction(budgetID, summary.TransactionIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if txs, _ = client.GetTransactionsByAccount(budgetID, accountID, nil); len(txs) != 1 {
+		t.Fatalf("expected 1 transaction after delete, got %d", len(txs))
+	}
+
+	var apiErr *api.Error
+	_, err = ynab.NewWithBaseURL("wrong", ts.URL+"/v1").GetBudgets()
+	if !errors.As(err, &apiErr) || apiErr.ID != "401" {
+		t.Fatalf("expected a 401 api error, got %v", err)
+	}
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	c, err := Load("../../../hack/mock-ynab.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRateLimit(0, 1)
+	ts := httptest.NewServer(NewHandler(c, ""))
+	defer ts.Close()
+
+	client := ynab.NewWithBaseURL("any", ts.URL+"/v1")
+	if _, err := client.GetBudgets(); err != nil {
+		t.Fatal(err)
+	}
+	if rl := client.RateLimit(); rl.Used != 1 || rl.Limit != 1 || rl.Remaining() != 0 {
+		t.Fatalf("unexpected rate limit %+v", rl)
+	}
+
+	// The mock asks to come back in an hour, which is past what the client
+	// is willing to wait, so it gives up straight away.
+	var apiErr *api.Error
+	if _, err := client.GetBudgets(); !errors.As(err, &apiErr) || apiErr.ID != "429" {
+		t.Fatalf("expected a 429 api error, got %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package ynab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+)
+
+// DefaultBaseURL is the YNAB v1 API endpoint.
+const DefaultBaseURL = "https://api.ynab.com/v1"
+
+// Retry policy for transient failures: up to maxRetries extra attempts,
+// doubling from baseBackoff, never waiting longer than maxBackoff at once.
+const (
+	maxRetries  = 4
+	baseBackoff = time.Second
+	maxBackoff  = 2 * time.Minute
+)
+
+// RateLimit is the request quota YNAB reported in its X-Rate-Limit header
+// (200 requests per hour and token at the time of writing).
+type RateLimit struct {
+	Used  int
+	Limit int
+	// At is when it was observed; zero until a response carried the header.
+	At time.Time
+}
+
+// Known reports whether any response carried quota information.
+func (r RateLimit) Known() bool {
+	return r.Limit > 0
+}
+
+// RateLimitWindow is the period YNAB counts requests over; a reading older
+// than that tells nothing about the current quota.
+const RateLimitWindow = time.Hour
+
+// Expired reports whether the reading is older than RateLimitWindow at now.
+func (r RateLimit) Expired(now time.Time) bool {
+	return !r.At.IsZero() && now.Sub(r.At) >= RateLimitWindow
+}
+
+// Remaining is how many requests are left in the current window.
+func (r RateLimit) Remaining() int {
+	if r.Used >= r.Limit {
+		return 0
+	}
+	return r.Limit - r.Used
+}
+
+// Retry describes a failed request about to be sent again.
+type Retry struct {
+	Method string
+	URL    string
+	// Attempt counts the retries of the request, from 1.
+	Attempt int
+	Wait    time.Duration
+	// Status is the HTTP status of the failed attempt, 0 for network
+	// errors, which Err holds.
+	Status int
+	Err    error
+}
+
+// RetryNotifier is implemented by clients that can report their retries,
+// e.g. to show why an apply is slow.
+type RetryNotifier interface {
+	// OnRetry registers fn to be called before every retry; nil removes it.
+	OnRetry(fn func(Retry))
+}
+
+// Request describes a request sent to YNAB; every attempt of a retried
+// request is one.
+type Request struct {
+	Method   string
+	URL      string
+	Duration time.Duration
+	// Status is the HTTP status of the response, 0 for network errors,
+	// which Err holds.
+	Status int
+	Err    error
+	// RateLimit is the quota known after the request.
+	RateLimit RateLimit
+}
+
+// Failed reports whether the request got no response or an error status.
+func (r Request) Failed() bool {
+	return r.Err != nil || r.Status >= 400
+}
+
+// RequestNotifier is implemented by clients that can report the requests
+// they send, e.g. for metrics.
+type RequestNotifier interface {
+	// OnRequest registers fn to be called after every request; nil removes
+	// it.
+	OnRequest(fn func(Request))
+}
+
+// BaseURL returns the API endpoint to talk to: $YNAB_BASE_URL when set (e.g.
+// a local `ynabu mock-ynab`), DefaultBaseURL otherwise.
+func BaseURL() string {
+	if u := os.Getenv("YNAB_BASE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return DefaultBaseURL
+}
+
+// httpClient implements api.ClientReaderWriter so the SDK services can be
+// pointed at any base URL. It mirrors the SDK's own client, which hardcodes
+// the production endpoint.
+type httpClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+
+	// Overridable in tests.
+	sleepFn func(time.Duration)
+	nowFn   func() time.Time
+
+	mu        sync.Mutex
+	rateLimit RateLimit
+	onRetry   func(Retry)
+	onRequest func(Request)
+}
+
+var _ api.ClientReaderWriter = (*httpClient)(nil)
+
+func (c *httpClient) GET(url string, responseModel interface{}) error {
+	return c.do(http.MethodGet, url, responseModel, nil)
+}
+
+func (c *httpClient) POST(url string, responseModel interface{}, requestBody []byte) error {
+	return c.do(http.MethodPost, url, responseModel, requestBody)
+}
+
+func (c *httpClient) PUT(url string, responseModel interface{}, requestBody []byte) error {
+	return c.do(http.MethodPut, url, responseModel, requestBody)
+}
+
+func (c *httpClient) PATCH(url string, responseModel interface{}, requestBody []byte) error {
+	return c.do(http.MethodPatch, url, responseModel, requestBody)
+}
+
+func (c *httpClient) DELETE(url string, responseModel interface{}) error {
+	return c.do(http.MethodDelete, url, responseModel, nil)
+}
+
+func (c *httpClient) do(method, url string, responseModel interface{}, requestBody []byte) error {
+	for attempt := 0; ; attempt++ {
+		start := c.now()
+		res, body, err := c.send(method, url, requestBody)
+		c.observe(Request{Method: method, URL: url, Duration: c.now().Sub(start), Status: status(res), Err: err, RateLimit: c.RateLimit()})
+		if err == nil && res.StatusCode < 400 {
+			return json.Unmarshal(body, responseModel)
+		}
+
+		wait, retry := c.backoff(method, res, err, attempt)
+		if !retry {
+			if err != nil {
+				return err
+			}
+			return apiError(method, url, res.StatusCode, body)
+		}
+		c.notify(Retry{Method: method, URL: url, Attempt: attempt + 1, Wait: wait, Status: status(res), Err: err})
+		c.sleep(wait)
+	}
+}
+
+// send performs a single request and records the quota YNAB reported.
+func (c *httpClient) send(method, url string, requestBody []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+url, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if rl, ok := parseRateLimit(res.Header.Get("X-Rate-Limit")); ok {
+		rl.At = c.now()
+		c.mu.Lock()
+		c.rateLimit = rl
+		c.mu.Unlock()
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
+
+// backoff decides whether a failed attempt is retried and how long to wait
+// first. Rate limited requests were never processed, so they are always
+// retried; network errors and 5xx only for idempotent methods, since a POST
+// may have created transactions before failing.
+func (c *httpClient) backoff(method string, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= maxRetries {
+		return 0, false
+	}
+
+	switch {
+	case err != nil:
+		if !idempotent(method) {
+			return 0, false
+		}
+	case res.StatusCode == http.StatusTooManyRequests:
+	case res.StatusCode >= 500:
+		if !idempotent(method) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	wait := baseBackoff << attempt
+	if res != nil {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After"), c.now()); ok {
+			wait = d
+		}
+	}
+	if wait > maxBackoff {
+		// Waiting out an hourly window is better left to the user.
+		return 0, false
+	}
+	return wait, true
+}
+
+func (c *httpClient) sleep(d time.Duration) {
+	if c.sleepFn != nil {
+		c.sleepFn(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+func (c *httpClient) now() time.Time {
+	if c.nowFn != nil {
+		return c.nowFn()
+	}
+	return time.Now()
+}
+
+// OnRetry implements RetryNotifier.
+func (c *httpClient) OnRetry(fn func(Retry)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRetry = fn
+}
+
+func (c *httpClient) notify(r Retry) {
+	c.mu.Lock()
+	fn := c.onRetry
+	c.mu.Unlock()
+	if fn != nil {
+		fn(r)
+	}
+}
+
+// OnRequest implements RequestNotifier.
+func (c *httpClient) OnRequest(fn func(Request)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRequest = fn
+}
+
+func (c *httpClient) observe(r Request) {
+	c.mu.Lock()
+	fn := c.onRequest
+	c.mu.Unlock()
+	if fn != nil {
+		fn(r)
+	}
+}
+
+func status(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode
+}
+
+// RateLimit returns the quota reported by the most recent response, unknown
+// once that is older than RateLimitWindow.
+func (c *httpClient) RateLimit() RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rateLimit.Expired(c.now()) {
+		return RateLimit{}
+	}
+	return c.rateLimit
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// apiError turns an error response into an *api.Error.
+func apiError(method, url string, status int, body []byte) error {
+	response := struct {
+		Error *api.Error `json:"error"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil || response.Error == nil {
+		// Forge an *api.Error, like the SDK does, when the body is not a
+		// YNAB error document (proxies, empty bodies...).
+		return &api.Error{
+			ID:     strconv.Itoa(status),
+			Name:   "unknown_api_error",
+			Detail: fmt.Sprintf("Unknown API error (%s %s)", method, url),
+		}
+	}
+	return response.Error
+}
+
+// parseRateLimit reads YNAB's X-Rate-Limit header, e.g. "36/200".
+func parseRateLimit(h string) (RateLimit, bool) {
+	usedStr, limitStr, ok := strings.Cut(h, "/")
+	if !ok {
+		return RateLimit{}, false
+	}
+	used, err1 := strconv.Atoi(strings.TrimSpace(usedStr))
+	limit, err2 := strconv.Atoi(strings.TrimSpace(limitStr))
+	if err1 != nil || err2 != nil || limit <= 0 {
+		return RateLimit{}, false
+	}
+	return RateLimit{Used: used, Limit: limit}, true
+}
+
+// parseRetryAfter accepts both forms of Retry-After: seconds or an HTTP date.
+func parseRetryAfter(h string, now time.Time) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
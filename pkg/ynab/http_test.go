@@ -0,0 +1,170 @@
+package ynab
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+)
+
+// flaky answers with the given statuses in order, then 200.
+func flaky(t *testing.T, statuses ...int) (*httpClient, *[]time.Duration, *int) {
+	t.Helper()
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rate-Limit", "42/200")
+		if hits < len(statuses) {
+			status := statuses[hits]
+			hits++
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "7")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		hits++
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	var waits []time.Duration
+	c := &httpClient{
+		baseURL: ts.URL,
+		token:   "t",
+		client:  ts.Client(),
+		sleepFn: func(d time.Duration) { waits = append(waits, d) },
+	}
+	return c, &waits, &hits
+}
+
+func TestRetryIdempotentOnServerErrors(t *testing.T) {
+	c, waits, hits := flaky(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	var res struct{}
+	if err := c.GET("/budgets", &res); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 3 {
+		t.Errorf("expected 3 attempts, got %d", *hits)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; len(*waits) != 2 || (*waits)[0] != want[0] || (*waits)[1] != want[1] {
+		t.Errorf("expected exponential backoff %v, got %v", want, *waits)
+	}
+	if rl := c.RateLimit(); rl.Used != 42 || rl.Limit != 200 || rl.Remaining() != 158 {
+		t.Errorf("unexpected rate limit %+v", rl)
+	}
+}
+
+func TestRetriesAreReported(t *testing.T) {
+	c, _, _ := flaky(t, http.StatusTooManyRequests)
+	var retries []Retry
+	c.OnRetry(func(r Retry) { retries = append(retries, r) })
+
+	var res struct{}
+	if err := c.GET("/budgets", &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(retries) != 1 || retries[0].Status != http.StatusTooManyRequests || retries[0].Wait != 7*time.Second || retries[0].Attempt != 1 {
+		t.Errorf("unexpected retries %+v", retries)
+	}
+}
+
+func TestNoRetryForPostOnServerError(t *testing.T) {
+	c, _, hits := flaky(t, http.StatusInternalServerError)
+
+	var res struct{}
+	err := c.POST("/budgets/b/transactions", &res, []byte(`{}`))
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) || apiErr.ID != "500" {
+		t.Fatalf("expected a 500 api error, got %v", err)
+	}
+	if *hits != 1 {
+		t.Errorf("a POST must not be retried after a 5xx, got %d attempts", *hits)
+	}
+}
+
+func TestRetryAfterOnRateLimit(t *testing.T) {
+	c, waits, hits := flaky(t, http.StatusTooManyRequests)
+
+	var res struct{}
+	if err := c.POST("/budgets/b/transactions", &res, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 2 || len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+		t.Errorf("expected one retry after 7s, got %d attempts and waits %v", *hits, *waits)
+	}
+}
+
+func TestGiveUpAfterMaxRetries(t *testing.T) {
+	statuses := make([]int, maxRetries+1)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	c, _, hits := flaky(t, statuses...)
+
+	var res struct{}
+	if err := c.DELETE("/budgets/b/transactions/x", &res); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *hits != maxRetries+1 {
+		t.Errorf("expected %d attempts, got %d", maxRetries+1, *hits)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 17, 12, 0, 0, 0, time.UTC)
+	if d, ok := parseRetryAfter("30", now); !ok || d != 30*time.Second {
+		t.Errorf("seconds: got %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now); !ok || d != time.Minute {
+		t.Errorf("http date: got %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Error("garbage must be ignored")
+	}
+}
+
+func TestRequestsAreReported(t *testing.T) {
+	c, _, _ := flaky(t, http.StatusServiceUnavailable)
+	var requests []Request
+	c.OnRequest(func(r Request) { requests = append(requests, r) })
+
+	var res struct{}
+	if err := c.GET("/budgets", &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests (one retried), got %+v", requests)
+	}
+	if !requests[0].Failed() || requests[0].Status != http.StatusServiceUnavailable {
+		t.Errorf("unexpected first request %+v", requests[0])
+	}
+	if requests[1].Failed() || requests[1].Method != http.MethodGet || requests[1].URL != "/budgets" {
+		t.Errorf("unexpected second request %+v", requests[1])
+	}
+	if rl := requests[1].RateLimit; rl.Remaining() != 158 {
+		t.Errorf("expected the quota after the request, got %+v", rl)
+	}
+}
+
+func TestRateLimitExpires(t *testing.T) {
+	c, _, _ := flaky(t)
+	now := time.Date(2025, 3, 17, 10, 0, 0, 0, time.UTC)
+	c.nowFn = func() time.Time { return now }
+
+	var res struct{}
+	if err := c.GET("/budgets", &res); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(RateLimitWindow - time.Minute)
+	if rl := c.RateLimit(); !rl.Known() || rl.Remaining() != 158 {
+		t.Errorf("expected the quota within the window, got %+v", rl)
+	}
+	now = now.Add(time.Minute)
+	if rl := c.RateLimit(); rl.Known() {
+		t.Errorf("expected a quota read an hour ago to be unknown, got %+v", rl)
+	}
+}
@@ -0,0 +1,181 @@
+package ynab
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/budget"
+)
+
+// Budget aliases understood by the YNAB API itself.
+const (
+	LastUsedBudget = "last-used"
+	DefaultBudget  = "default"
+)
+
+// uuidPattern matches YNAB IDs, which are resolved without a request.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// AmbiguousError is returned when a name matches more than one budget or
+// account.
+type AmbiguousError struct {
+	Kind string // "budget" or "account"
+	Name string
+	IDs  []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("%s name %q is ambiguous, it matches %s; use the ID instead", e.Kind, e.Name, strings.Join(e.IDs, ", "))
+}
+
+// NotFoundError is returned when no budget or account has the given name or
+// ID.
+type NotFoundError struct {
+	Kind  string
+	Name  string
+	Known []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no %s named %q (known: %s)", e.Kind, e.Name, strings.Join(e.Known, ", "))
+}
+
+// Resolver turns budget and account names into IDs. Listings are fetched once
+// per Resolver and reused, so resolving every statement of a manifest costs
+// one request per budget.
+type Resolver struct {
+	client Client
+
+	mu       sync.Mutex
+	budgets  []*budget.Summary
+	aliases  map[string]string
+	accounts map[string][]*account.Account
+}
+
+// NewResolver returns a resolver backed by client.
+func NewResolver(client Client) *Resolver {
+	return &Resolver{client: client, aliases: make(map[string]string), accounts: make(map[string][]*account.Account)}
+}
+
+// Budget resolves a budget ID or name. The "last-used" and "default"
+// aliases are resolved to the ID they stand for now, so what is stored
+// keeps pointing at the same budget; UUIDs and the empty string are
+// returned unchanged.
+func (r *Resolver) Budget(ref string) (string, error) {
+	if ref == "" || uuidPattern.MatchString(ref) {
+		return ref, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ref == LastUsedBudget || ref == DefaultBudget {
+		if id, ok := r.aliases[ref]; ok {
+			return id, nil
+		}
+		id, err := r.client.GetBudgetID(ref)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the %s budget: %w", ref, err)
+		}
+		r.aliases[ref] = id
+		return id, nil
+	}
+	budgets, err := r.listBudgets()
+	if err != nil {
+		return "", err
+	}
+
+	var ids, names []string
+	for _, b := range budgets {
+		if b.ID == ref {
+			return b.ID, nil
+		}
+		if strings.EqualFold(b.Name, ref) {
+			ids = append(ids, b.ID)
+		}
+		names = append(names, b.Name)
+	}
+	return pick("budget", ref, ids, names)
+}
+
+// BudgetName returns the name of the budget with the given ID, or "" when it
+// is an alias or cannot be listed. It is meant for display only.
+func (r *Resolver) BudgetName(id string) string {
+	if id == "" || id == LastUsedBudget || id == DefaultBudget {
+		return ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	budgets, err := r.listBudgets()
+	if err != nil {
+		return ""
+	}
+	for _, b := range budgets {
+		if b.ID == id {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// listBudgets returns the budget listing, fetching it on first use. r.mu must
+// be held.
+func (r *Resolver) listBudgets() ([]*budget.Summary, error) {
+	if r.budgets == nil {
+		budgets, err := r.client.GetBudgets()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list budgets: %w", err)
+		}
+		r.budgets = budgets
+	}
+	return r.budgets, nil
+}
+
+// Account resolves an account ID or name within budgetID. UUIDs are returned
+// unchanged; closed accounts are only matched by ID.
+func (r *Resolver) Account(budgetID, ref string) (string, error) {
+	if uuidPattern.MatchString(ref) {
+		return ref, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	accounts, ok := r.accounts[budgetID]
+	if !ok {
+		var err error
+		accounts, err = r.client.GetAccounts(budgetID)
+		if err != nil {
+			return "", fmt.Errorf("failed to list accounts: %w", err)
+		}
+		r.accounts[budgetID] = accounts
+	}
+
+	var ids, names []string
+	for _, a := range accounts {
+		if a.ID == ref {
+			return a.ID, nil
+		}
+		if a.Closed || a.Deleted {
+			continue
+		}
+		if strings.EqualFold(a.Name, ref) {
+			ids = append(ids, a.ID)
+		}
+		names = append(names, a.Name)
+	}
+	return pick("account", ref, ids, names)
+}
+
+func pick(kind, ref string, ids, names []string) (string, error) {
+	switch len(ids) {
+	case 0:
+		return "", &NotFoundError{Kind: kind, Name: ref, Known: names}
+	case 1:
+		return ids[0], nil
+	default:
+		return "", &AmbiguousError{Kind: kind, Name: ref, IDs: ids}
+	}
+}
@@ -0,0 +1,56 @@
+package ynab_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yurifrl/ynabu/pkg/ynab"
+	"github.com/yurifrl/ynabu/pkg/ynab/fake"
+)
+
+func TestResolver(t *testing.T) {
+	client := fake.New()
+	client.AddBudget("b-family", "Family")
+	client.AddBudget("b-work", "Work")
+	client.AddAccount("b-family", "a-itau", "Itaú Conta Corrente")
+	client.AddAccount("b-family", "a-card-1", "Cartão")
+	client.AddAccount("b-family", "a-card-2", "Cartão")
+
+	r := ynab.NewResolver(client)
+
+	if id, err := r.Budget("family"); err != nil || id != "b-family" {
+		t.Fatalf("budget by name: got %q, %v", id, err)
+	}
+	for _, alias := range []string{ynab.LastUsedBudget, ynab.DefaultBudget, ynab.LastUsedBudget} {
+		if id, err := r.Budget(alias); err != nil || id != "b-family" {
+			t.Fatalf("%s must resolve to the budget it stands for: got %q, %v", alias, id, err)
+		}
+	}
+	if n := client.Calls("GetBudgetID"); n != 2 {
+		t.Errorf("expected each alias to be resolved once, got %d", n)
+	}
+	if id, err := r.Account("b-family", "Itaú Conta Corrente"); err != nil || id != "a-itau" {
+		t.Fatalf("account by name: got %q, %v", id, err)
+	}
+	if id, err := r.Account("b-family", "a-itau"); err != nil || id != "a-itau" {
+		t.Fatalf("account by ID: got %q, %v", id, err)
+	}
+
+	var ambiguous *ynab.AmbiguousError
+	if _, err := r.Account("b-family", "Cartão"); !errors.As(err, &ambiguous) || len(ambiguous.IDs) != 2 {
+		t.Fatalf("expected an ambiguity error, got %v", err)
+	}
+	var notFound *ynab.NotFoundError
+	if _, err := r.Budget("Holidays"); !errors.As(err, &notFound) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	// Listings are fetched once.
+	_, _ = r.Account("b-family", "Itaú Conta Corrente")
+	if n := client.Calls("GetAccounts"); n != 1 {
+		t.Errorf("expected accounts to be listed once, got %d", n)
+	}
+	if n := client.Calls("GetBudgets"); n != 1 {
+		t.Errorf("expected budgets to be listed once, got %d", n)
+	}
+}
@@ -0,0 +1,57 @@
+package ynab
+
+import (
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/budget"
+)
+
+// BudgetView is the machine-readable form of a budget, shared by
+// `ynabu budgets -o json` and the HTTP API.
+type BudgetView struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	LastModifiedOn *time.Time `json:"last_modified_on,omitempty"`
+}
+
+// AccountView is the machine-readable form of an account, shared by
+// `ynabu accounts -o json` and the HTTP API. Balance is in currency units
+// rather than YNAB's milliunits.
+type AccountView struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	OnBudget bool    `json:"on_budget"`
+	Closed   bool    `json:"closed"`
+	Balance  float64 `json:"balance"`
+}
+
+// NewBudgetViews converts budget summaries into their machine-readable form.
+func NewBudgetViews(budgets []*budget.Summary) []BudgetView {
+	views := make([]BudgetView, 0, len(budgets))
+	for _, b := range budgets {
+		views = append(views, BudgetView{ID: b.ID, Name: b.Name, LastModifiedOn: b.LastModifiedOn})
+	}
+	return views
+}
+
+// NewAccountViews converts accounts into their machine-readable form,
+// leaving out deleted ones and, unless closed is set, closed ones.
+func NewAccountViews(accounts []*account.Account, closed bool) []AccountView {
+	views := make([]AccountView, 0, len(accounts))
+	for _, a := range accounts {
+		if a.Deleted || (a.Closed && !closed) {
+			continue
+		}
+		views = append(views, AccountView{
+			ID:       a.ID,
+			Name:     a.Name,
+			Type:     string(a.Type),
+			OnBudget: a.OnBudget,
+			Closed:   a.Closed,
+			Balance:  float64(a.Balance) / 1000.0,
+		})
+	}
+	return views
+}
@@ -1,25 +1,62 @@
 package ynab
 
 import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
-	"github.com/brunomvsouza/ynab.go"
+	"github.com/brunomvsouza/ynab.go/api"
 	"github.com/brunomvsouza/ynab.go/api/account"
 	"github.com/brunomvsouza/ynab.go/api/budget"
+	"github.com/brunomvsouza/ynab.go/api/category"
+	"github.com/brunomvsouza/ynab.go/api/payee"
 	"github.com/brunomvsouza/ynab.go/api/transaction"
+	"github.com/brunomvsouza/ynab.go/api/user"
 )
 
-// YNABClient wraps the original YNAB client and adds custom functionality
-type YNABClient struct {
-	client ynab.ClientServicer
+// Client is the subset of the YNAB API used by ynabu. YNABClient implements
+// it against the real service; package fake provides an in-memory
+// implementation for tests.
+type Client interface {
+	// GetUser returns the user the token belongs to; it is the cheapest way
+	// to check a token.
+	GetUser() (*user.User, error)
+	GetBudgets() ([]*budget.Summary, error)
+	// GetBudgetID returns the ID of the budget budgetID stands for, which
+	// resolves the "last-used" and "default" aliases.
+	GetBudgetID(budgetID string) (string, error)
+	GetAccounts(budgetID string) ([]*account.Account, error)
+	GetCategories(budgetID string) ([]*category.GroupWithCategories, error)
+	GetPayees(budgetID string) ([]*payee.Payee, error)
+
+	GetTransactionsByAccount(budgetID, accountID string, filter *transaction.Filter) ([]*Transaction, error)
+	// GetTransactionsDelta returns the transactions of an account changed
+	// after lastKnowledge (0 fetches everything), deleted ones included,
+	// together with the current server knowledge.
+	GetTransactionsDelta(budgetID, accountID string, since *api.Date, lastKnowledge uint64) ([]*Transaction, uint64, error)
+	CreateTransactions(budgetID string, payloads []transaction.PayloadTransaction) (*transaction.OperationSummary, error)
+	UpdateTransactions(budgetID string, payloads []transaction.PayloadTransaction) (*transaction.OperationSummary, error)
+	DeleteTransaction(budgetID, transactionID string) error
+	// RateLimit returns the API quota observed so far.
+	RateLimit() RateLimit
 }
 
-// TransactionService wraps the original transaction service
-type TransactionService struct {
-	client   *YNABClient
-	original *transaction.Service
+// YNABClient wraps the original YNAB services and adds custom functionality
+type YNABClient struct {
+	http        *httpClient
+	budget      *budget.Service
+	account     *account.Service
+	category    *category.Service
+	payee       *payee.Service
+	transaction *transaction.Service
+	user        *user.Service
 }
 
+var _ Client = (*YNABClient)(nil)
+
 // Transaction wraps the core YNAB transaction adding CustomID extracted from
 // the memo first CSV field.
 type Transaction struct {
@@ -39,36 +76,97 @@ func extractCustomID(tx *transaction.Transaction) string {
 	return ""
 }
 
+// NewTransaction wraps a SDK transaction, extracting its CustomID.
+func NewTransaction(tx *transaction.Transaction) *Transaction {
+	return &Transaction{Transaction: tx, customID: extractCustomID(tx)}
+}
+
+// New returns a client for the API at BaseURL().
 func New(token string) *YNABClient {
+	return NewWithBaseURL(token, BaseURL())
+}
+
+// NewWithBaseURL returns a client for the API rooted at baseURL, e.g.
+// "http://localhost:8081/v1" for a local `ynabu mock-ynab`.
+func NewWithBaseURL(token, baseURL string) *YNABClient {
+	hc := &httpClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  http.DefaultClient,
+	}
 	return &YNABClient{
-		client: ynab.NewClient(token),
+		http:        hc,
+		budget:      budget.NewService(hc),
+		account:     account.NewService(hc),
+		category:    category.NewService(hc),
+		payee:       payee.NewService(hc),
+		transaction: transaction.NewService(hc),
+		user:        user.NewService(hc),
+	}
+}
+
+func (c *YNABClient) RateLimit() RateLimit {
+	return c.http.RateLimit()
+}
+
+// OnRetry implements RetryNotifier.
+func (c *YNABClient) OnRetry(fn func(Retry)) {
+	c.http.OnRetry(fn)
+}
+
+// OnRequest implements RequestNotifier.
+func (c *YNABClient) OnRequest(fn func(Request)) {
+	c.http.OnRequest(fn)
+}
+
+func (c *YNABClient) GetUser() (*user.User, error) {
+	return c.user.GetUser()
+}
+
+func (c *YNABClient) GetBudgets() ([]*budget.Summary, error) {
+	return c.budget.GetBudgets()
+}
+
+// GetBudgetID asks for the changes to the budget after the highest possible
+// server knowledge, so the response is its ID and name without the export.
+func (c *YNABClient) GetBudgetID(budgetID string) (string, error) {
+	res, err := c.budget.GetBudget(budgetID, &api.Filter{LastKnowledgeOfServer: math.MaxInt64})
+	if err != nil {
+		return "", err
+	}
+	if res.Budget == nil || res.Budget.ID == "" {
+		return "", fmt.Errorf("budget %q has no ID", budgetID)
 	}
+	return res.Budget.ID, nil
 }
 
-func (c *YNABClient) Transaction() *TransactionService {
-	return &TransactionService{
-		client:   c,
-		original: c.client.Transaction(),
+func (c *YNABClient) GetAccounts(budgetID string) ([]*account.Account, error) {
+	res, err := c.account.GetAccounts(budgetID, nil)
+	if err != nil {
+		return nil, err
 	}
+	return res.Accounts, nil
 }
 
-func (c *YNABClient) Budget() *budget.Service {
-	return c.client.Budget()
+func (c *YNABClient) GetCategories(budgetID string) ([]*category.GroupWithCategories, error) {
+	res, err := c.category.GetCategories(budgetID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.GroupWithCategories, nil
 }
 
-func (c *YNABClient) Account() *account.Service {
-	return c.client.Account()
+func (c *YNABClient) GetPayees(budgetID string) ([]*payee.Payee, error) {
+	res, err := c.payee.GetPayees(budgetID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Payees, nil
 }
 
-func (ts *TransactionService) GetTransactionsByAccount(budgetID, accountID string, filter interface{}) ([]*Transaction, error) {
+func (c *YNABClient) GetTransactionsByAccount(budgetID, accountID string, filter *transaction.Filter) ([]*Transaction, error) {
 	// Call the original client
-	var filterPtr *transaction.Filter
-	if filter != nil {
-		if f, ok := filter.(*transaction.Filter); ok {
-			filterPtr = f
-		}
-	}
-	originalTransactions, err := ts.original.GetTransactionsByAccount(budgetID, accountID, filterPtr)
+	originalTransactions, err := c.transaction.GetTransactionsByAccount(budgetID, accountID, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -76,19 +174,64 @@ func (ts *TransactionService) GetTransactionsByAccount(budgetID, accountID strin
 	// Convert to our extended Transaction type with TransactionID
 	transactions := make([]*Transaction, 0, len(originalTransactions))
 	for _, tx := range originalTransactions {
-		customID := extractCustomID(tx)
-		transactions = append(transactions, &Transaction{Transaction: tx, customID: customID})
+		transactions = append(transactions, NewTransaction(tx))
 	}
 
 	return transactions, nil
 }
 
+func (c *YNABClient) GetTransactionsDelta(budgetID, accountID string, since *api.Date, lastKnowledge uint64) ([]*Transaction, uint64, error) {
+	// The SDK drops server_knowledge from transaction listings, so this one
+	// talks to the endpoint directly.
+	q := url.Values{}
+	if since != nil && !since.IsZero() {
+		q.Set("since_date", api.DateFormat(*since))
+	}
+	if lastKnowledge > 0 {
+		q.Set("last_knowledge_of_server", strconv.FormatUint(lastKnowledge, 10))
+	}
+	path := fmt.Sprintf("/budgets/%s/accounts/%s/transactions", budgetID, accountID)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	resModel := struct {
+		Data struct {
+			Transactions    []*transaction.Transaction `json:"transactions"`
+			ServerKnowledge uint64                     `json:"server_knowledge"`
+		} `json:"data"`
+	}{}
+	if err := c.http.GET(path, &resModel); err != nil {
+		return nil, 0, err
+	}
+
+	transactions := make([]*Transaction, 0, len(resModel.Data.Transactions))
+	for _, tx := range resModel.Data.Transactions {
+		transactions = append(transactions, NewTransaction(tx))
+	}
+	return transactions, resModel.Data.ServerKnowledge, nil
+}
+
 // CreateTransactions creates multiple transactions in one API call
-func (ts *TransactionService) CreateTransactions(budgetID string, payloads []transaction.PayloadTransaction) error {
+func (c *YNABClient) CreateTransactions(budgetID string, payloads []transaction.PayloadTransaction) (*transaction.OperationSummary, error) {
 	if len(payloads) == 0 {
-		return nil
+		return &transaction.OperationSummary{}, nil
 	}
-	_, err := ts.original.CreateTransactions(budgetID, payloads)
+	return c.transaction.CreateTransactions(budgetID, payloads)
+}
+
+// UpdateTransactions updates multiple existing transactions in one API call.
+// Every payload must carry the ID of the transaction it replaces.
+func (c *YNABClient) UpdateTransactions(budgetID string, payloads []transaction.PayloadTransaction) (*transaction.OperationSummary, error) {
+	if len(payloads) == 0 {
+		return &transaction.OperationSummary{}, nil
+	}
+	return c.transaction.UpdateTransactions(budgetID, payloads)
+}
+
+// DeleteTransaction deletes a single transaction by its YNAB ID.
+func (c *YNABClient) DeleteTransaction(budgetID, transactionID string) error {
+	_, err := c.transaction.DeleteTransaction(budgetID, transactionID)
 	return err
 }
 